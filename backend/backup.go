@@ -0,0 +1,286 @@
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is part of backup file names and sorts chronologically
+const backupTimeFormat = "20060102-150405"
+
+// backupPrefix returns the file name prefix of backups of the configured
+// database, e.g. "ml_preferences-" for data/ml_preferences.db
+func backupPrefix() string {
+	base := filepath.Base(Cfg.ML.DBPath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// listBackups returns the backups in ml.backup.dir, oldest first
+func listBackups() ([]string, error) {
+	entries, err := os.ReadDir(Cfg.ML.Backup.Dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := backupPrefix()
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), prefix) && strings.HasSuffix(e.Name(), ".db") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ScheduledBackup writes a timestamped backup to ml.backup.dir and deletes
+// the oldest ones beyond ml.backup.keep. It returns the new file's path.
+func ScheduledBackup() (string, error) {
+	cfg := Cfg.ML.Backup
+	if cfg.Dir == "" {
+		return "", fmt.Errorf("ml.backup.dir is not set")
+	}
+	// Backups hold every user's click history, so keep them private
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(cfg.Dir, backupPrefix()+time.Now().UTC().Format(backupTimeFormat)+".db")
+	if err := BackupStore(path); err != nil {
+		return "", err
+	}
+
+	names, err := listBackups()
+	if err != nil {
+		return path, fmt.Errorf("failed to list backups: %w", err)
+	}
+	for len(names) > cfg.Keep && cfg.Keep > 0 {
+		if err := os.Remove(filepath.Join(cfg.Dir, names[0])); err != nil {
+			return path, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		log.Printf("Removed old backup %s", names[0])
+		names = names[1:]
+	}
+	return path, nil
+}
+
+// BackupWorker runs ScheduledBackup every ml.backup.intervalHours. After a
+// restart the schedule continues from the newest existing backup.
+func BackupWorker(ctx context.Context) {
+	cfg := Cfg.ML.Backup
+	if cfg.Dir == "" || cfg.IntervalHours <= 0 {
+		return
+	}
+	interval := time.Duration(cfg.IntervalHours) * time.Hour
+
+	next := time.Now()
+	if names, err := listBackups(); err == nil && len(names) > 0 {
+		if info, err := os.Stat(filepath.Join(cfg.Dir, names[len(names)-1])); err == nil {
+			next = info.ModTime().Add(interval)
+		}
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if path, err := ScheduledBackup(); err != nil {
+			log.Printf("Backup failed: %v", err)
+		} else {
+			log.Printf("Backed up database to %s", path)
+		}
+		next = time.Now().Add(interval)
+	}
+}
+
+// HandleBackupDownload streams a fresh, consistent copy of the database
+func HandleBackupDownload(w http.ResponseWriter, r *http.Request) {
+	dir, err := os.MkdirTemp("", "dashboard-backup-")
+	if err != nil {
+		log.Printf("Backup download failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := backupPrefix() + time.Now().UTC().Format(backupTimeFormat) + ".db"
+	path := filepath.Join(dir, name)
+	if err := BackupStore(path); err != nil {
+		log.Printf("Backup download failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Backup download failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	userID, _ := AuthenticatedUser(r.Context())
+	log.Printf("Database backup downloaded by %q", userID)
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, name, time.Now(), f)
+}
+
+// ValidateBackup checks that path is an intact dashboard database this
+// binary can migrate, and returns its schema version. Files copied before
+// schema versioning existed report version 0.
+func ValidateBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	check, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer check.Close()
+
+	var result string
+	if err := check.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("%s is not a readable SQLite database: %w", path, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%s failed the integrity check: %s", path, result)
+	}
+
+	tables := map[string]bool{}
+	rows, err := check.Query("SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tables[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, table := range []string{"click_events", "token_weights"} {
+		if !tables[table] {
+			return 0, fmt.Errorf("%s is not a dashboard database (no %s table)", path, table)
+		}
+	}
+
+	version := 0
+	if tables["schema_migrations"] {
+		if err := check.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+			return 0, fmt.Errorf("failed to read schema version: %w", err)
+		}
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if latest := migrations[len(migrations)-1].version; version > latest {
+		return 0, fmt.Errorf("%s has schema version %d, newer than this binary supports (%d)", path, version, latest)
+	}
+	return version, nil
+}
+
+// RestoreStore replaces the database at dbPath with a validated backup. The
+// database must not be open anywhere: the current file is only renamed
+// aside (with its WAL), never opened, so a corrupt or too new database can
+// be replaced too. It returns the path the previous database was moved to.
+func RestoreStore(dbPath, backupPath string) (string, error) {
+	if _, err := ValidateBackup(backupPath); err != nil {
+		return "", err
+	}
+
+	lock, err := lockStore(dbPath, true)
+	if errors.Is(err, errStoreLocked) {
+		return "", fmt.Errorf("%s is in use; stop the server and other dashboard commands first", dbPath)
+	} else if err != nil {
+		return "", err
+	}
+	defer lock.Close()
+
+	// The current database keeps its WAL so the moved copy opens intact
+	var previous string
+	var moved []string
+	undo := func() {
+		for _, suffix := range moved {
+			os.Rename(previous+suffix, dbPath+suffix)
+		}
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		previous = dbPath + ".before-restore-" + time.Now().UTC().Format(backupTimeFormat)
+		for i := 2; ; i++ {
+			if _, err := os.Stat(previous); os.IsNotExist(err) {
+				break
+			}
+			previous = fmt.Sprintf("%s.before-restore-%s-%d", dbPath, time.Now().UTC().Format(backupTimeFormat), i)
+		}
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Rename(dbPath+suffix, previous+suffix); err != nil && !os.IsNotExist(err) {
+				undo()
+				return "", fmt.Errorf("failed to move the current database aside: %w", err)
+			} else if err == nil {
+				moved = append(moved, suffix)
+			}
+		}
+	}
+
+	// Copy next to the database first so the swap itself is an atomic rename
+	tmp := dbPath + ".restoring"
+	if err := copyFile(backupPath, tmp); err != nil {
+		os.Remove(tmp)
+		undo()
+		return "", fmt.Errorf("failed to copy backup: %w", err)
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		os.Remove(tmp)
+		undo()
+		return "", fmt.Errorf("failed to replace database: %w", err)
+	}
+	lock.Close()
+
+	// Reopening brings an older backup up to the current schema
+	return previous, OpenStore(dbPath)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,103 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dashboardCacheMaxAge bounds how long a serialized response is reused even
+// without a generation change, because items age out of the top-rated window
+const dashboardCacheMaxAge = time.Minute
+
+// cacheGeneration is bumped whenever FeedCache or TokenWeights change. Cached
+// responses from an older generation are stale.
+var cacheGeneration atomic.Uint64
+
+// BumpCacheGeneration invalidates all pre-serialized dashboard responses
+func BumpCacheGeneration() {
+	cacheGeneration.Add(1)
+}
+
+// dashboardCacheEntry is a serialized APIResponse for one user
+type dashboardCacheEntry struct {
+	generation uint64
+	createdAt  time.Time
+	body       []byte
+	etag       string
+}
+
+var (
+	dashboardCache   = map[string]*dashboardCacheEntry{}
+	dashboardCacheMu sync.Mutex
+)
+
+// contentETag returns a strong ETag derived from the response body
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches implements the weak comparison used for If-None-Match. The
+// compression middleware weakens ETags, so W/ prefixes are ignored.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedDashboardResponse returns the serialized dashboard for a user and its
+// ETag, re-encoding only when feeds or weights changed since the last call
+func cachedDashboardResponse(userID string) ([]byte, string, error) {
+	generation := cacheGeneration.Load()
+
+	dashboardCacheMu.Lock()
+	entry := dashboardCache[userID]
+	dashboardCacheMu.Unlock()
+	if entry != nil && entry.generation == generation && time.Since(entry.createdAt) < dashboardCacheMaxAge {
+		return entry.body, entry.etag, nil
+	}
+
+	response := APIResponse{
+		Feeds:    GetAllFeeds(),
+		TopRated: GetTopRatedItems(userID, topRatedDashboardLimit),
+		Version:  AppVersion,
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(response); err != nil {
+		return nil, "", err
+	}
+
+	entry = &dashboardCacheEntry{
+		generation: generation,
+		createdAt:  time.Now(),
+		body:       buf.Bytes(),
+		etag:       contentETag(buf.Bytes()),
+	}
+	dashboardCacheMu.Lock()
+	dashboardCache[userID] = entry
+	dashboardCacheMu.Unlock()
+
+	return entry.body, entry.etag, nil
+}
+
+// dropDashboardCache forgets the cached response of a deleted user
+func dropDashboardCache(userID string) {
+	dashboardCacheMu.Lock()
+	delete(dashboardCache, userID)
+	dashboardCacheMu.Unlock()
+}
@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressMinSize is the smallest known body worth compressing
+const compressMinSize = 1024
+
+var gzipWriterPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+var brotliWriterPool = sync.Pool{
+	New: func() any { return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression) },
+}
+
+// negotiateEncoding picks br or gzip from Accept-Encoding, honouring q=0 and
+// preferring br when both are equally acceptable
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 || (name != "br" && name != "gzip") {
+			continue
+		}
+		if q > bestQ || (q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// isCompressible reports whether a content type benefits from compression
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "xml"):
+		return true
+	case mediaType == "application/javascript", mediaType == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// compressWriter decides on the first WriteHeader/Write whether to compress,
+// based on the status, content type and length set by the handler
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	writer      io.WriteCloser
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	length, lengthErr := strconv.Atoi(h.Get("Content-Length"))
+	compress := status != http.StatusNoContent && status != http.StatusNotModified &&
+		status != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" &&
+		isCompressible(h.Get("Content-Type")) &&
+		(lengthErr != nil || length >= compressMinSize)
+
+	if compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		// The encoded body differs byte-wise, so a strong ETag would be wrong
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		switch cw.encoding {
+		case "br":
+			bw := brotliWriterPool.Get().(*brotli.Writer)
+			bw.Reset(cw.ResponseWriter)
+			cw.writer = bw
+		default:
+			gw := gzipWriterPool.Get().(*gzip.Writer)
+			gw.Reset(cw.ResponseWriter)
+			cw.writer = gw
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.writer == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.writer.Write(b)
+}
+
+// Flush pushes buffered compressed data to the client
+func (cw *compressWriter) Flush() {
+	if f, ok := cw.writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the compressed stream and returns the writer to its pool
+func (cw *compressWriter) close() {
+	switch w := cw.writer.(type) {
+	case *gzip.Writer:
+		w.Close()
+		gzipWriterPool.Put(w)
+	case *brotli.Writer:
+		w.Close()
+		brotliWriterPool.Put(w)
+	}
+}
+
+// CompressionMiddleware compresses responses with brotli or gzip depending on
+// the client's Accept-Encoding. Small, already encoded and non-text bodies
+// are passed through unchanged.
+func CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		// Byte ranges refer to the identity encoding
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -1,27 +1,138 @@
 package backend
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
-// LoadConfig reads and parses the YAML configuration file
+// ConfigPath is the configuration file read by LoadConfig (-config flag or
+// DASHBOARD_CONFIG)
+var ConfigPath = "config.yaml"
+
+// parseConfigFile reads the config file and its config.d fragments, expands
+// ${VAR} references, applies DASHBOARD_* environment overrides and defaults,
+// and validates the result. All problems found are returned together.
+func parseConfigFile(path string) (Config, error) {
+	var cfg Config
+	files, err := configFiles(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	src := &configSource{files: map[*yaml.Node]string{}}
+	var errs []error
+	for _, file := range files {
+		node, err := parseConfigNode(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, checkConfigFile(file, node)...)
+		src.add(file, node)
+		if src.root == nil {
+			src.root = node
+		} else {
+			mergeConfigNodes(src.root, node)
+		}
+	}
+	if len(errs) > 0 {
+		return cfg, errors.Join(errs...)
+	}
+
+	if err := src.root.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if src.env, err = applyEnvOverrides(&cfg); err != nil {
+		return cfg, fmt.Errorf("invalid environment override: %w", err)
+	}
+	applyConfigDefaults(&cfg)
+	if err := validateConfig(&cfg, src); err != nil {
+		return cfg, err
+	}
+	cfg.Feeds = combineFeedCategories(cfg.Feeds)
+	return cfg, nil
+}
+
+// LoadConfig reads and parses the YAML configuration file (see parseConfigFile)
 func LoadConfig() error {
-	data, err := os.ReadFile("config.yaml")
+	cfg, err := parseConfigFile(ConfigPath)
 	if err != nil {
-		return fmt.Errorf("error reading config.yaml: %w", err)
+		return err
+	}
+	Cfg = cfg
+
+	if err := SetTrustedProxies(Cfg.Server.TrustedProxies, Cfg.Server.ForwardedHeader); err != nil {
+		return fmt.Errorf("invalid server.trustedProxies in %s: %w", ConfigPath, err)
 	}
 
-	if err := yaml.Unmarshal(data, &Cfg); err != nil {
-		return fmt.Errorf("error parsing config.yaml: %w", err)
+	if err := SetBasePath(Cfg.Server.BasePath); err != nil {
+		return fmt.Errorf("invalid server.basePath in %s: %w", ConfigPath, err)
+	}
+
+	if err := ApplyLimits(Cfg.Server.Limits); err != nil {
+		return fmt.Errorf("invalid server.limits in %s: %w", ConfigPath, err)
+	}
+
+	if err := ApplyCORS(Cfg.Server.CORS); err != nil {
+		return fmt.Errorf("invalid server.cors in %s: %w", ConfigPath, err)
+	}
+
+	if err := ApplySecurity(Cfg.Server.Security); err != nil {
+		return fmt.Errorf("invalid server.security in %s: %w", ConfigPath, err)
 	}
 
 	return nil
 }
 
+// WatchConfig reloads the hot-reloadable settings (server.limits,
+// server.cors, server.security and server.trustedProxies) when the config
+// file or a config.d fragment changes, or on SIGHUP. Other settings still
+// require a restart.
+func WatchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	lastMod, _ := configModTime(ConfigPath)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("SIGHUP received, reloading %s", ConfigPath)
+			lastMod, _ = configModTime(ConfigPath)
+		case <-ticker.C:
+			modTime, err := configModTime(ConfigPath)
+			if err != nil || modTime.Equal(lastMod) {
+				continue
+			}
+			lastMod = modTime
+			log.Printf("%s changed, reloading", ConfigPath)
+		}
+
+		cfg, err := parseConfigFile(ConfigPath)
+		if err != nil {
+			log.Printf("Warning: config reload failed, keeping previous limits: %v", err)
+			continue
+		}
+		if err := reloadLimits(cfg); err != nil {
+			log.Printf("Warning: config reload failed, keeping previous limits: %v", err)
+		}
+	}
+}
+
 // InitFeedCache initializes the feed cache with entries for all configured sources
 func InitFeedCache() {
 	FeedCache = make(map[string]*FeedCacheEntry)
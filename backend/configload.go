@@ -0,0 +1,245 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix prefixes environment overrides of config fields, e.g.
+// DASHBOARD_SERVER_PORT for server.port
+const envPrefix = "DASHBOARD_"
+
+// ConfigEnvVar selects the config file when -config is not given
+const ConfigEnvVar = envPrefix + "CONFIG"
+
+// otherEnvVars are DASHBOARD_* variables read elsewhere, not config overrides
+var otherEnvVars = []string{
+	ConfigEnvVar, "DASHBOARD_VERSION", "DASHBOARD_HMAC_SECRET", "DASHBOARD_HMAC_KEYS",
+	"DASHBOARD_HMAC_KEYRING", "DASHBOARD_SESSION_SECRET",
+}
+
+// envRefPattern matches ${VAR} and ${VAR:-default}
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// configFragmentDir returns the config.d directory next to the config file
+func configFragmentDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "config.d")
+}
+
+// configFiles returns the config file followed by its config.d/*.yaml
+// fragments in lexical order
+func configFiles(path string) ([]string, error) {
+	files := []string{path}
+	entries, err := os.ReadDir(configFragmentDir(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", configFragmentDir(path), err)
+	}
+
+	var fragments []string
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if !e.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			fragments = append(fragments, filepath.Join(configFragmentDir(path), e.Name()))
+		}
+	}
+	sort.Strings(fragments)
+	return append(files, fragments...), nil
+}
+
+// configModTime returns the newest modification time of the config file,
+// the config.d directory and its fragments, so that WatchConfig notices
+// added, changed and removed fragments
+func configModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	latest := info.ModTime()
+	if info, err := os.Stat(configFragmentDir(path)); err == nil && info.ModTime().After(latest) {
+		latest = info.ModTime()
+	}
+	files, err := configFiles(path)
+	if err != nil {
+		return latest, nil
+	}
+	for _, f := range files[1:] {
+		if info, err := os.Stat(f); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// parseConfigNode parses one YAML file and expands ${VAR} references in its
+// scalar values. Comments and keys are left alone, and an expanded value is
+// never parsed as YAML structure.
+func parseConfigNode(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		// Empty file
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: top level is not a mapping", path)
+	}
+
+	var errs []error
+	expandEnvRefs(root, func(n *yaml.Node, name string) {
+		errs = append(errs, fmt.Errorf("%s:%d: environment variable %s is not set", path, n.Line, name))
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return root, nil
+}
+
+func expandEnvRefs(n *yaml.Node, undefined func(*yaml.Node, string)) {
+	if n.Kind == yaml.MappingNode {
+		// Only values; keys are field names
+		for i := 1; i < len(n.Content); i += 2 {
+			expandEnvRefs(n.Content[i], undefined)
+		}
+		return
+	}
+	for _, child := range n.Content {
+		expandEnvRefs(child, undefined)
+	}
+	if n.Kind != yaml.ScalarNode || !strings.Contains(n.Value, "${") {
+		return
+	}
+
+	n.Value = envRefPattern.ReplaceAllStringFunc(n.Value, func(ref string) string {
+		m := envRefPattern.FindStringSubmatch(ref)
+		if value, ok := os.LookupEnv(m[1]); ok {
+			return value
+		}
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+		undefined(n, m[1])
+		return ""
+	})
+	// Re-resolve the type of plain scalars, so `port: ${PORT}` is an int
+	if n.Style == 0 {
+		n.Tag = ""
+	}
+}
+
+// mergeConfigNodes merges a config.d fragment into the config: mappings are
+// merged key by key, lists are extended (e.g. extra feed categories) and
+// other values are replaced
+func mergeConfigNodes(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		existing := -1
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value == key.Value {
+				existing = j + 1
+				break
+			}
+		}
+		switch {
+		case existing < 0:
+			dst.Content = append(dst.Content, key, value)
+		case dst.Content[existing].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeConfigNodes(dst.Content[existing], value)
+		case dst.Content[existing].Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			dst.Content[existing].Content = append(dst.Content[existing].Content, value.Content...)
+		default:
+			dst.Content[existing] = value
+		}
+	}
+}
+
+// applyEnvOverrides sets config fields from DASHBOARD_* variables named after
+// their YAML path, e.g. DASHBOARD_SERVER_PORT or DASHBOARD_ML_DBPATH. Strings
+// are taken as is, string lists may be comma-separated, anything else is
+// parsed as YAML (e.g. DASHBOARD_SERVER_CORS_ALLOWEDORIGINS='["https://a.example"]').
+// It returns the names of the variables that were applied.
+func applyEnvOverrides(cfg *Config) ([]string, error) {
+	fields := map[string]reflect.Value{}
+	collectEnvFields(reflect.ValueOf(cfg).Elem(), strings.TrimSuffix(envPrefix, "_"), fields)
+
+	var applied []string
+	var errs []error
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envPrefix) || slices.Contains(otherEnvVars, name) {
+			continue
+		}
+		field, ok := fields[name]
+		if !ok {
+			log.Printf("Warning: %s does not match any config field", name)
+			continue
+		}
+		if err := setEnvField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		applied = append(applied, name)
+	}
+	return applied, errors.Join(errs...)
+}
+
+func collectEnvFields(v reflect.Value, prefix string, fields map[string]reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		fields[name] = v.Field(i)
+		if v.Field(i).Kind() == reflect.Struct {
+			collectEnvFields(v.Field(i), name, fields)
+		}
+	}
+}
+
+func setEnvField(field reflect.Value, value string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+		return nil
+	}
+
+	target := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(value), target.Interface()); err != nil {
+		return fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	field.Set(target.Elem())
+	return nil
+}
@@ -0,0 +1,245 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	defaultCORSMethods        = []string{"GET", "HEAD", "POST"}
+	defaultCORSHeaders        = []string{"Content-Type", "X-HMAC-Signature", "X-CSRF-Token"}
+	defaultCORSExposedHeaders = []string{"ETag", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}
+)
+
+// originPattern is a compiled allowedOrigins entry
+type originPattern struct {
+	any    bool   // "*"
+	scheme string // lower-case
+	host   string // exact host, or the suffix after "*." for wildcards
+	port   string
+	wild   bool
+}
+
+func parseOriginPattern(raw string) (originPattern, error) {
+	if raw == "*" {
+		return originPattern{any: true}, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return originPattern{}, fmt.Errorf("invalid origin %q (expected scheme://host[:port])", raw)
+	}
+	p := originPattern{scheme: strings.ToLower(u.Scheme), host: strings.ToLower(u.Hostname()), port: u.Port()}
+	if suffix, ok := strings.CutPrefix(p.host, "*."); ok {
+		p.host, p.wild = suffix, true
+	}
+	if strings.Contains(p.host, "*") {
+		return originPattern{}, fmt.Errorf("invalid origin %q (only a leading *. wildcard is supported)", raw)
+	}
+	return p, nil
+}
+
+func (p originPattern) matches(origin *url.URL) bool {
+	if p.any {
+		return true
+	}
+	host := strings.ToLower(origin.Hostname())
+	if strings.ToLower(origin.Scheme) != p.scheme || origin.Port() != p.port {
+		return false
+	}
+	if p.wild {
+		// *.example.com matches sub.example.com but not example.com itself
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// corsRoute holds the methods and headers allowed for one path
+type corsRoute struct {
+	methods []string
+	headers []string
+}
+
+// corsPolicy is the compiled, immutable form of server.cors. It is swapped
+// atomically on config reload.
+type corsPolicy struct {
+	origins     []originPattern
+	credentials bool
+	maxAge      int
+	exposed     []string
+	defaults    corsRoute
+	routes      map[string]corsRoute
+}
+
+var currentCORS atomic.Pointer[corsPolicy]
+
+func init() {
+	currentCORS.Store(&corsPolicy{})
+}
+
+func trimAll(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, strings.TrimSpace(v))
+	}
+	return out
+}
+
+func upperAll(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, strings.ToUpper(strings.TrimSpace(v)))
+	}
+	return out
+}
+
+// ApplyCORS compiles server.cors and makes it active
+func ApplyCORS(cfg CORSConfig) error {
+	policy, err := compileCORS(cfg)
+	if err != nil {
+		return err
+	}
+	currentCORS.Store(policy)
+	return nil
+}
+
+func compileCORS(cfg CORSConfig) (*corsPolicy, error) {
+	policy := &corsPolicy{
+		credentials: cfg.AllowCredentials,
+		maxAge:      cfg.MaxAgeSeconds,
+		exposed:     defaultCORSExposedHeaders,
+		defaults:    corsRoute{methods: defaultCORSMethods, headers: defaultCORSHeaders},
+		routes:      map[string]corsRoute{},
+	}
+	if policy.maxAge == 0 {
+		policy.maxAge = 600
+	}
+
+	for _, raw := range cfg.AllowedOrigins {
+		p, err := parseOriginPattern(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		if p.any && cfg.AllowCredentials {
+			return nil, fmt.Errorf(`allowedOrigins "*" cannot be combined with allowCredentials`)
+		}
+		policy.origins = append(policy.origins, p)
+	}
+
+	if len(cfg.AllowedMethods) > 0 {
+		policy.defaults.methods = upperAll(cfg.AllowedMethods)
+	}
+	if len(cfg.AllowedHeaders) > 0 {
+		policy.defaults.headers = trimAll(cfg.AllowedHeaders)
+	}
+	if len(cfg.ExposedHeaders) > 0 {
+		policy.exposed = trimAll(cfg.ExposedHeaders)
+	}
+
+	for path, route := range cfg.Routes {
+		compiled := policy.defaults
+		if len(route.AllowedMethods) > 0 {
+			compiled.methods = upperAll(route.AllowedMethods)
+		}
+		if len(route.AllowedHeaders) > 0 {
+			compiled.headers = trimAll(route.AllowedHeaders)
+		}
+		policy.routes[strings.TrimSuffix(path, "/")] = compiled
+	}
+
+	return policy, nil
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for an Origin
+// header, or "" when the origin is not allowed
+func (p *corsPolicy) allowOrigin(origin string) string {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	for _, pattern := range p.origins {
+		if pattern.matches(u) {
+			if pattern.any {
+				return "*"
+			}
+			return origin
+		}
+	}
+	return ""
+}
+
+// route returns the policy of the longest configured path that is the
+// request path or one of its parent directories
+func (p *corsPolicy) route(path string) corsRoute {
+	best, bestLen := p.defaults, -1
+	for prefix, route := range p.routes {
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > bestLen {
+			best, bestLen = route, len(prefix)
+		}
+	}
+	return best
+}
+
+// CORSMiddleware applies the server.cors policy. Without allowedOrigins no
+// CORS headers are sent, so only same-origin pages can call the API.
+func CORSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := currentCORS.Load()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		allowed := ""
+		if origin != "" {
+			allowed = policy.allowOrigin(origin)
+		}
+		if allowed == "" {
+			if preflight {
+				// Answer without CORS headers; the browser blocks the request
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if policy.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.exposed, ", "))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := policy.route(r.URL.Path)
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		if !slices.Contains(route.methods, method) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			h = strings.TrimSpace(h)
+			if h != "" && !slices.ContainsFunc(route.headers, func(allowed string) bool { return strings.EqualFold(allowed, h) }) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(route.methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(route.headers, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(policy.maxAge))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
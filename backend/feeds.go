@@ -117,7 +117,14 @@ func FetchFeed(ctx context.Context, source FeedSource, category string) (*FeedCa
 				return
 			}
 
+			var categoryFilters FilterConfig
+			if cat, ok := findCategory(category); ok {
+				categoryFilters = cat.Filters
+			}
+			filter := newItemFilter(categoryFilters, source.Filters)
+
 			items := []*FeedItem{}
+			filtered := 0
 			for _, item := range parsedFeed.Items {
 				if item == nil {
 					continue
@@ -128,21 +135,32 @@ func FetchFeed(ctx context.Context, source FeedSource, category string) (*FeedCa
 					pubTime = *item.PublishedParsed
 				}
 
-				items = append(items, &FeedItem{
+				author := ""
+				if item.Author != nil {
+					author = item.Author.Name
+				}
+
+				feedItem := &FeedItem{
 					Title:       item.Title,
 					Link:        item.Link,
 					PublishedAt: pubTime,
 					Source:      source.Name,
 					Category:    category,
 					Description: item.Description,
+					Author:      author,
 					GUID:        item.GUID,
-				})
+				}
+				if !filter.Allow(feedItem) {
+					filtered++
+					continue
+				}
+				items = append(items, feedItem)
 			}
 
 			if len(items) == 0 {
-				log.Printf("Warning: No items parsed from %s (%s)", source.Name, source.URL)
+				log.Printf("Warning: No items parsed from %s (%s), %d filtered", source.Name, source.URL, filtered)
 			} else {
-				log.Printf("Parsed %d items from %s", len(items), source.Name)
+				log.Printf("Parsed %d items from %s, %d filtered", len(items), source.Name, filtered)
 			}
 
 			// Sort by published date, newest first
@@ -151,6 +169,11 @@ func FetchFeed(ctx context.Context, source FeedSource, category string) (*FeedCa
 			})
 
 			entry.Items = items
+			entry.Filtered = filtered
+			BumpCacheGeneration()
+			if err := SaveFeedItems(category, source.Name, items); err != nil {
+				log.Printf("Failed to persist items of %s: %v", source.Name, err)
+			}
 			entry.LastFetch = time.Now()
 			entry.NextRefresh = time.Now().Add(entry.Interval)
 			lastErr = nil
@@ -184,12 +207,20 @@ func RefreshFeedsWorker(ctx context.Context) {
 			return
 		case <-ticker.C:
 			now := time.Now()
-			for _, category := range Cfg.Feeds {
+			// Feeds can be added at runtime (OPML import), so read them under the lock
+			FeedCacheMu.RLock()
+			feeds := Cfg.Feeds
+			FeedCacheMu.RUnlock()
+
+			for _, category := range feeds {
 				for _, source := range category.Sources {
 					cacheKey := fmt.Sprintf("%s:%s", category.Category, source.Name)
+					FeedCacheMu.RLock()
 					entry := FeedCache[cacheKey]
+					due := entry != nil && now.After(entry.NextRefresh)
+					FeedCacheMu.RUnlock()
 
-					if now.After(entry.NextRefresh) {
+					if due {
 						log.Printf("Refreshing feed: %s:%s", category.Category, source.Name)
 						FeedCacheMu.Lock()
 						_, err := FetchFeed(ctx, source, category.Category)
@@ -215,9 +246,10 @@ func GetAllFeeds() []FeedGroup {
 	for _, category := range Cfg.Feeds {
 		for _, source := range category.Sources {
 			cacheKey := fmt.Sprintf("%s:%s", category.Category, source.Name)
-			group := FeedGroup{Source: source.Name, Category: category.Category, Color: category.Color, SiteURL: source.Site, Items: []FeedItem{}}
+			group := FeedGroup{ID: SourceID(category.Category, source.Name), Source: source.Name, Category: category.Category, Color: category.Color, SiteURL: source.Site, Items: []FeedItem{}}
 
 			if entry, ok := FeedCache[cacheKey]; ok {
+				group.Filtered = entry.Filtered
 				for _, item := range entry.Items {
 					item.Score = 0 // Will be scored later if needed
 					group.Items = append(group.Items, *item)
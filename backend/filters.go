@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// compiledPatterns caches compiled filter regexes keyed by their source pattern
+var (
+	compiledPatterns   = map[string]*regexp.Regexp{}
+	compiledPatternsMu sync.Mutex
+)
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	compiledPatternsMu.Lock()
+	defer compiledPatternsMu.Unlock()
+
+	if re, ok := compiledPatterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	compiledPatterns[pattern] = re
+	return re, nil
+}
+
+// validateFilterConfig compiles every filter pattern so that typos are
+// reported at startup instead of silently letting items through
+func validateFilterConfig(fc FilterConfig) error {
+	for _, rule := range append(append([]FilterRule{}, fc.Include...), fc.Exclude...) {
+		switch rule.Field {
+		case "title", "link", "author":
+		default:
+			return fmt.Errorf("unknown filter field %q (expected title, link or author)", rule.Field)
+		}
+		if _, err := compilePattern(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid filter pattern %q: %w", rule.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// itemFilter is the combined category and source filter applied to fetched items
+type itemFilter struct {
+	include         []FilterRule
+	exclude         []FilterRule
+	minTitleLength  int
+	dropWithoutLink bool
+}
+
+// newItemFilter merges category-level and source-level rules. Rules from both
+// levels apply; for scalar settings the source wins when it sets a value.
+func newItemFilter(category, source FilterConfig) itemFilter {
+	f := itemFilter{
+		include:         append(append([]FilterRule{}, category.Include...), source.Include...),
+		exclude:         append(append([]FilterRule{}, category.Exclude...), source.Exclude...),
+		minTitleLength:  category.MinTitleLength,
+		dropWithoutLink: category.DropWithoutLink || source.DropWithoutLink,
+	}
+	if source.MinTitleLength > 0 {
+		f.minTitleLength = source.MinTitleLength
+	}
+	return f
+}
+
+// Allow reports whether an item passes the filter. Include rules are OR-ed:
+// when any are configured, an item must match at least one of them.
+func (f itemFilter) Allow(item *FeedItem) bool {
+	if f.dropWithoutLink && strings.TrimSpace(item.Link) == "" {
+		return false
+	}
+	if f.minTitleLength > 0 && len([]rune(strings.TrimSpace(item.Title))) < f.minTitleLength {
+		return false
+	}
+	for _, rule := range f.exclude {
+		if rule.matches(item) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, rule := range f.include {
+		if rule.matches(item) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule FilterRule) matches(item *FeedItem) bool {
+	re, err := compilePattern(rule.Pattern)
+	if err != nil {
+		return false
+	}
+
+	switch rule.Field {
+	case "title":
+		return re.MatchString(item.Title)
+	case "link":
+		return re.MatchString(item.Link)
+	case "author":
+		return re.MatchString(item.Author)
+	}
+	return false
+}
+
+// findCategory returns the configured category with the given name
+func findCategory(name string) (FeedCategory, bool) {
+	for _, category := range Cfg.Feeds {
+		if category.Category == name {
+			return category, true
+		}
+	}
+	return FeedCategory{}, false
+}
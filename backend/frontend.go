@@ -0,0 +1,171 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indexFile is served for "/" and for client-side routes (SPA fallback)
+const indexFile = "index.html"
+
+// assetRefPattern finds relative href/src references in index.html that can
+// be rewritten to content-hashed URLs
+var assetRefPattern = regexp.MustCompile(`(href|src)="([^"?#:]+)"`)
+
+func init() {
+	// Not in every system mime table
+	mime.AddExtensionType(".webmanifest", "application/manifest+json")
+}
+
+// frontendAsset is a file of the frontend with its precomputed validators
+type frontendAsset struct {
+	body        []byte
+	contentType string
+	hash        string // first 16 hex chars of the SHA-256 of body
+}
+
+// frontendAssets serves the frontend from an fs.FS (normally embedded in the
+// binary). In dev mode files are re-read on every request so edits show up
+// without a restart.
+type frontendAssets struct {
+	fsys   fs.FS
+	dev    bool
+	mu     sync.RWMutex
+	assets map[string]*frontendAsset
+}
+
+var frontend *frontendAssets
+
+// SetFrontend selects the filesystem the frontend is served from. dev
+// disables caching of file contents and long-lived Cache-Control headers.
+func SetFrontend(fsys fs.FS, dev bool) error {
+	fa := &frontendAssets{fsys: fsys, dev: dev}
+	if err := fa.load(); err != nil {
+		return err
+	}
+	if _, ok := fa.assets[indexFile]; !ok {
+		return fmt.Errorf("frontend has no %s", indexFile)
+	}
+	frontend = fa
+	return nil
+}
+
+func newFrontendAsset(name string, body []byte) *frontendAsset {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	sum := sha256.Sum256(body)
+	return &frontendAsset{body: body, contentType: contentType, hash: hex.EncodeToString(sum[:])[:16]}
+}
+
+// load reads every file of the frontend, so new assets (icons, manifest, ...)
+// are served without code changes. index.html is rewritten to reference the
+// other assets by content hash and gets a <base> for server.basePath.
+func (fa *frontendAssets) load() error {
+	assets := map[string]*frontendAsset{}
+	err := fs.WalkDir(fa.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		body, err := fs.ReadFile(fa.fsys, name)
+		if err != nil {
+			return err
+		}
+		assets[name] = newFrontendAsset(name, body)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error loading frontend: %w", err)
+	}
+
+	if index, ok := assets[indexFile]; ok {
+		rewritten := assetRefPattern.ReplaceAllFunc(index.body, func(match []byte) []byte {
+			parts := assetRefPattern.FindSubmatch(match)
+			ref := strings.TrimPrefix(string(parts[2]), "/")
+			asset, ok := assets[ref]
+			if !ok || ref == indexFile {
+				return match
+			}
+			return []byte(fmt.Sprintf(`%s="%s?v=%s"`, parts[1], parts[2], asset.hash))
+		})
+		// Resolve relative asset and API URLs against server.basePath, also
+		// from nested client-side routes
+		if !bytes.Contains(rewritten, []byte("<base ")) {
+			rewritten = bytes.Replace(rewritten, []byte("<head>"), []byte(`<head>
+  <base href="`+basePath+`/" />`), 1)
+		}
+		assets[indexFile] = newFrontendAsset(indexFile, rewritten)
+	}
+
+	fa.mu.Lock()
+	fa.assets = assets
+	fa.mu.Unlock()
+	return nil
+}
+
+func (fa *frontendAssets) lookup(name string) (*frontendAsset, bool) {
+	if fa.dev {
+		if err := fa.load(); err != nil {
+			log.Printf("Warning: failed to reload frontend: %v", err)
+		}
+	}
+	fa.mu.RLock()
+	defer fa.mu.RUnlock()
+	asset, ok := fa.assets[name]
+	return asset, ok
+}
+
+// HandleFrontend serves the SPA and its static assets. Requests carrying the
+// current content hash (?v=) are cacheable forever; everything else is
+// revalidated with a strong ETag. Unknown paths without a file extension get
+// index.html so client-side routes work on reload.
+func HandleFrontend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if frontend == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	if name == "" {
+		name = indexFile
+	}
+
+	asset, ok := frontend.lookup(name)
+	if !ok {
+		if path.Ext(name) != "" || strings.HasPrefix(name, "api/") {
+			http.NotFound(w, r)
+			return
+		}
+		name = indexFile
+		asset, _ = frontend.lookup(indexFile)
+	}
+
+	w.Header().Set("Content-Type", asset.contentType)
+	w.Header().Set("ETag", `"`+asset.hash+`"`)
+	switch {
+	case frontend.dev:
+		w.Header().Set("Cache-Control", "no-cache")
+	case name != indexFile && r.URL.Query().Get("v") == asset.hash:
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(asset.body))
+}
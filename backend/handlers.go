@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"path/filepath"
 	"time"
 )
 
@@ -19,41 +18,45 @@ import (
 //     find enough visible matches to fill the badge quota.
 const topRatedDashboardLimit = 25
 
-// CORSMiddleware adds CORS headers to all responses
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-// HandleDashboard returns the complete dashboard data
+// HandleDashboard returns the dashboard data, optionally narrowed by query
+// parameters (see DashboardQuery)
 func HandleDashboard(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	feeds := GetAllFeeds()
-	topRated := GetTopRatedItems(topRatedDashboardLimit)
+	query, err := ParseDashboardQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The full response is cached per user until feeds or weights change
+	userID := UserFromContext(r.Context())
+	var body []byte
+	var etag string
+	if query.IsDefault() {
+		body, etag, err = cachedDashboardResponse(userID)
+	} else {
+		body, etag, err = shapedDashboardResponse(userID, query)
+	}
+	if err != nil {
+		log.Printf("Failed to encode dashboard response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-	response := APIResponse{
-		Feeds:    feeds,
-		TopRated: topRated,
-		Version:  AppVersion,
+	w.Header().Set("ETag", etag)
+	// Always revalidate; the response depends on the authenticated user
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache, max-age=60")
-	json.NewEncoder(w).Encode(response)
+	w.Write(body)
 }
 
 // HandleClickFeedback records user click feedback for ML training
@@ -70,6 +73,7 @@ func HandleClickFeedback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	feedback.Timestamp = time.Now()
+	feedback.UserID = UserFromContext(r.Context())
 
 	// Build a stable identity key: prefer link, fall back to title
 	if feedback.ItemLink != "" {
@@ -82,36 +86,9 @@ func HandleClickFeedback(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Failed to persist click feedback: %v", err)
 	}
 
-	log.Printf("Recorded click feedback: %s", feedback.ItemTitle)
+	log.Printf("Recorded click feedback for %s: %s", feedback.UserID, feedback.ItemTitle)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "recorded"})
 }
-
-// HandleFrontend serves the frontend HTML
-const frontendDir = "./frontend"
-
-// HandleFrontend serves the SPA and static assets (HTML/CSS/JS)
-func HandleFrontend(w http.ResponseWriter, r *http.Request) {
-	// Serve the main page at root
-	if r.URL.Path == "/" {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		http.ServeFile(w, r, filepath.Join(frontendDir, "index.html"))
-		return
-	}
-
-	if r.URL.Path == "/styles.css" {
-		w.Header().Set("Content-Type", "text/css; charset=utf-8")
-		http.ServeFile(w, r, filepath.Join(frontendDir, "styles.css"))
-		return
-	}
-
-	if r.URL.Path == "/scripts.js" {
-		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
-		http.ServeFile(w, r, filepath.Join(frontendDir, "scripts.js"))
-		return
-	}
-
-	http.NotFound(w, r)
-}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -14,108 +15,226 @@ import (
 	"time"
 )
 
-// HMACConfig holds the shared secret for HMAC authentication
-type HMACConfig struct {
-	Secret string
-}
+// InitHMAC loads the HMAC keyring. Keys come from DASHBOARD_HMAC_SECRET
+// (key ID "default"), DASHBOARD_HMAC_KEYS and the optional keyring file at
+// keyringPath (overridden by DASHBOARD_HMAC_KEYRING). Must be called after
+// OpenStore so that revocations and user profiles are available.
+func InitHMAC(keyringPath string) error {
+	if envPath := os.Getenv("DASHBOARD_HMAC_KEYRING"); envPath != "" {
+		keyringPath = envPath
+	}
+
+	envKeys, err := parseEnvKeys()
+	if err != nil {
+		return err
+	}
+	keyring.envKeys = envKeys
+	keyring.path = keyringPath
+
+	if Cfg.Auth.NonceCacheSize > 0 {
+		nonceCache = NewNonceCache(Cfg.Auth.NonceCacheSize)
+	}
 
-var hmacAuth HMACConfig
+	if err := keyring.load(); err != nil {
+		return err
+	}
+	if err := keyring.loadRevocations(); err != nil {
+		return err
+	}
 
-// InitHMAC loads or generates the HMAC secret
-func InitHMAC(secretPath string) error {
-	// In production, load from secure storage (env var, vault, etc.)
-	// For now, check if DASHBOARD_HMAC_SECRET env var is set
-	secret := os.Getenv("DASHBOARD_HMAC_SECRET")
-	if secret == "" {
-		log.Println("WARNING: DASHBOARD_HMAC_SECRET not set. HMAC auth disabled.")
+	if !keyring.Configured() {
+		log.Println("WARNING: no HMAC keys configured (DASHBOARD_HMAC_SECRET, DASHBOARD_HMAC_KEYS or keyring file). HMAC auth disabled.")
 		log.Println("WARNING: You can generate a secret like this: head -c 32 /dev/urandom | base64")
 		return nil
 	}
-	hmacAuth.Secret = secret
-	log.Println("HMAC authentication enabled")
+	keyring.mu.RLock()
+	keyCount := len(keyring.keys)
+	keyring.mu.RUnlock()
+	log.Printf("HMAC authentication enabled (%d keys, %d user profiles)", keyCount, len(ListUsers()))
 	return nil
 }
 
-// ComputeSignature generates HMAC-SHA256 signature for a request
-func ComputeSignature(secret, method, path, timestamp, body string) string {
+// ComputeSignature generates HMAC-SHA256 signature for a request.
+// An empty nonce produces the legacy payload without a nonce field.
+func ComputeSignature(secret, method, path, timestamp, nonce, body string) string {
 	payload := fmt.Sprintf("%s|%s|%s|%s", method, path, timestamp, body)
+	if nonce != "" {
+		payload = fmt.Sprintf("%s|%s|%s|%s|%s", method, path, timestamp, nonce, body)
+	}
 	h := hmac.New(sha256.New, []byte(secret))
 	h.Write([]byte(payload))
 	return hex.EncodeToString(h.Sum(nil))
 }
 
 // VerifyHMACSignature checks if request signature is valid
-// Signature header format: "timestamp:signature"
-// Returns: (valid, errorMessage)
-func VerifyHMACSignature(r *http.Request, requireSecret bool) (bool, string) {
-	if hmacAuth.Secret == "" {
+// Signature header format: "v2:keyID:timestamp:nonce:signature" (canonical
+// request incl. query and headers, see CanonicalRequestV2) or the legacy v1
+// "keyID:timestamp:nonce:signature". A user ID works as key ID for its
+// profile secret. The nonce-less v1 forms "timestamp:signature" (key
+// "default") and "keyID:timestamp:signature" are only accepted when
+// auth.allowMissingNonce is set.
+// Returns: (userID, valid, errorMessage)
+func VerifyHMACSignature(r *http.Request, requireSecret bool) (string, bool, string) {
+	if !keyring.Configured() {
 		if requireSecret {
-			return false, "HMAC authentication not configured on server"
+			return "", false, "HMAC authentication not configured on server"
 		}
 		// HMAC not configured and not required, allow all
-		return true, ""
+		return DefaultUserID, true, ""
 	}
 
 	// Get signature header
 	authHeader := r.Header.Get("X-HMAC-Signature")
 	if authHeader == "" {
-		return false, "missing X-HMAC-Signature header"
+		return "", false, "missing X-HMAC-Signature header"
 	}
 
 	parts := strings.Split(authHeader, ":")
-	if len(parts) != 2 {
-		return false, "invalid signature format (expected timestamp:signature)"
+	version := "v1"
+	if len(parts) == 5 && parts[0] == SignatureV2 {
+		version, parts = SignatureV2, parts[1:]
 	}
 
-	timestamp := parts[0]
-	clientSig := parts[1]
+	var keyID, timestamp, nonce, clientSig string
+	switch len(parts) {
+	case 2:
+		keyID, timestamp, clientSig = DefaultKeyID, parts[0], parts[1]
+	case 3:
+		keyID, timestamp, clientSig = parts[0], parts[1], parts[2]
+	case 4:
+		keyID, timestamp, nonce, clientSig = parts[0], parts[1], parts[2], parts[3]
+	default:
+		return "", false, "invalid signature format (expected v2:keyID:timestamp:nonce:signature)"
+	}
 
-	// Verify timestamp is recent (within 2 minutes)
+	key, errMsg := keyring.Resolve(keyID)
+	if key == nil {
+		keyring.record(keyID, errMsg)
+		return "", false, fmt.Sprintf("%s (key %s)", errMsg, keyID)
+	}
+
+	fail := func(msg string) (string, bool, string) {
+		keyring.record(keyID, msg)
+		return "", false, fmt.Sprintf("%s (key %s)", msg, keyID)
+	}
+
+	if nonce == "" && (version == SignatureV2 || !Cfg.Auth.AllowMissingNonce) {
+		return fail("missing nonce")
+	}
+	if nonce != "" && !noncePattern.MatchString(nonce) {
+		return fail("invalid nonce (expected 8-64 characters of [A-Za-z0-9_-])")
+	}
+
+	// Verify timestamp is within the allowed clock skew window
 	ts, err := strconv.ParseInt(timestamp, 10, 64)
 	if err != nil {
-		return false, "invalid timestamp"
+		return fail("invalid timestamp")
 	}
 
+	maxAge, maxFuture := Cfg.Auth.SkewWindow()
 	requestTime := time.Unix(ts, 0)
-	if time.Since(requestTime) > 2*time.Minute {
-		return false, "request timestamp too old"
+	if time.Since(requestTime) > maxAge {
+		return fail("request timestamp too old")
 	}
 
-	if time.Until(requestTime) > 30*time.Second {
-		return false, "request timestamp in future"
+	if time.Until(requestTime) > maxFuture {
+		return fail("request timestamp in future")
 	}
 
 	// Read request body
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		return false, "failed to read request body"
+		return fail("failed to read request body")
 	}
 	// Restore body for handler
 	r.Body = io.NopCloser(strings.NewReader(string(bodyBytes)))
 
 	// Compute expected signature
-	expectedSig := ComputeSignature(hmacAuth.Secret, r.Method, r.URL.Path, timestamp, string(bodyBytes))
+	var expectedSig string
+	if version == SignatureV2 {
+		canonical := CanonicalRequestV2(r.Method, r.URL.Path, r.URL.Query(), r.Header, timestamp, nonce, bodyBytes)
+		expectedSig = ComputeSignatureV2(key.Secret, canonical)
+	} else {
+		expectedSig = ComputeSignature(key.Secret, r.Method, r.URL.Path, timestamp, nonce, string(bodyBytes))
+	}
 
 	// Constant-time comparison
 	if !hmac.Equal([]byte(clientSig), []byte(expectedSig)) {
-		return false, "invalid signature"
+		return fail("invalid signature")
 	}
 
-	return true, ""
+	// Only remember nonces of correctly signed requests so that unauthenticated
+	// clients cannot fill the cache. A nonce must stay remembered for as long
+	// as its timestamp could still be accepted.
+	if nonce != "" {
+		if ok, msg := nonceCache.Use(keyID, nonce, maxAge+maxFuture); !ok {
+			return fail(msg)
+		}
+	}
+
+	if version != SignatureV2 {
+		log.Printf("Deprecated v1 HMAC signature used by key %s", keyID)
+	}
+	keyring.record(keyID, "")
+	return key.User, true, ""
 }
 
 // RequireHMACAuth middleware enforces HMAC signature verification
 // requireSecret=true means endpoint requires HMAC to be configured
+// The authenticated user ID is available to handlers via UserFromContext.
 func RequireHMACAuth(handler http.Handler, requireSecret bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		valid, errMsg := VerifyHMACSignature(r, requireSecret)
+		userID, valid, errMsg := VerifyHMACSignature(r, requireSecret)
 		if !valid {
 			log.Printf("HMAC auth failed: %s from %s", errMsg, r.RemoteAddr)
 			http.Error(w, fmt.Sprintf("Unauthorized: %s", errMsg), http.StatusUnauthorized)
 			return
 		}
 
-		log.Printf("HMAC auth passed for %s %s", r.Method, r.URL.Path)
+		log.Printf("HMAC auth passed for %s %s (user %s)", r.Method, r.URL.Path, userID)
+		handler.ServeHTTP(w, r.WithContext(withSignedUser(r.Context(), userID)))
+	})
+}
+
+// OptionalHMACAuth identifies the user when a signature is present and treats
+// unsigned requests as the default user. Invalid signatures are still rejected.
+func OptionalHMACAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Without keys there is nothing to verify against; stay anonymous
+		if r.Header.Get("X-HMAC-Signature") == "" || !keyring.Configured() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		userID, valid, errMsg := VerifyHMACSignature(r, false)
+		if !valid {
+			log.Printf("HMAC auth failed: %s from %s", errMsg, r.RemoteAddr)
+			http.Error(w, fmt.Sprintf("Unauthorized: %s", errMsg), http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r.WithContext(withSignedUser(r.Context(), userID)))
+	})
+}
+
+// signedRequestKey marks requests authenticated by an HMAC signature rather
+// than a session cookie
+type signedRequestKey struct{}
+
+func withSignedUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(WithUser(ctx, userID), signedRequestKey{}, true)
+}
+
+// RequireSignature rejects requests that are not HMAC-signed, including
+// logged-in browser sessions. Use it inside the route's auth middleware for
+// endpoints a stolen session cookie must not reach.
+func RequireSignature(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signed, _ := r.Context().Value(signedRequestKey{}).(bool); !signed {
+			log.Printf("Unsigned request to %s rejected from %s", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "Forbidden: this endpoint requires an HMAC-signed request", http.StatusForbidden)
+			return
+		}
 		handler.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,291 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	sourceItemsDefaultLimit = 20
+	sourceItemsMaxLimit     = 100
+	// defaultHistoryRetentionDays applies when refresh.historyRetentionDays is unset
+	defaultHistoryRetentionDays = 30
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// SourceID returns the stable identifier of a source used in
+// /api/sources/{id}/items, e.g. "tech--ars-technica" or "новости--медуза".
+// Slugs never contain "--", so the separator keeps "a-b"/"c" and "a"/"b-c"
+// apart. A name without letters or digits is identified by a hash instead.
+func SourceID(category, source string) string {
+	slug := func(s string) string {
+		var b strings.Builder
+		dash := false
+		for _, r := range strings.ToLower(s) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || (unicode.IsMark(r) && b.Len() > 0) {
+				b.WriteRune(r)
+				dash = false
+			} else if !dash && b.Len() > 0 {
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+		if b.Len() == 0 {
+			// "_" never appears in slugs, so hashed names cannot clash with them
+			sum := sha256.Sum256([]byte(s))
+			return "_" + hex.EncodeToString(sum[:4])
+		}
+		return strings.TrimSuffix(b.String(), "-")
+	}
+	return slug(category) + "--" + slug(source)
+}
+
+// findSource resolves a source ID to its category and source names
+func findSource(id string) (string, string, bool) {
+	FeedCacheMu.RLock()
+	defer FeedCacheMu.RUnlock()
+
+	for _, category := range Cfg.Feeds {
+		for _, source := range category.Sources {
+			if SourceID(category.Category, source.Name) == id {
+				return category.Category, source.Name, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// LookupSource finds a configured source by source ID, "category:name" or,
+// when unambiguous, its name alone. It returns the source and its category.
+func LookupSource(ref string) (FeedSource, string, error) {
+	FeedCacheMu.RLock()
+	defer FeedCacheMu.RUnlock()
+
+	var matches []FeedSource
+	var categories []string
+	for _, category := range Cfg.Feeds {
+		for _, source := range category.Sources {
+			if SourceID(category.Category, source.Name) == ref || category.Category+":"+source.Name == ref {
+				return source, category.Category, nil
+			}
+			if source.Name == ref {
+				matches = append(matches, source)
+				categories = append(categories, category.Category)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return FeedSource{}, "", fmt.Errorf("no source %q", ref)
+	case 1:
+		return matches[0], categories[0], nil
+	default:
+		return FeedSource{}, "", fmt.Errorf("source name %q is ambiguous (in %s); use category:name", ref, strings.Join(categories, ", "))
+	}
+}
+
+// feedItemKey identifies an item within its source: GUID, else link, else title
+func feedItemKey(item *FeedItem) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	if item.Link != "" {
+		return item.Link
+	}
+	return item.Title
+}
+
+// SaveFeedItems adds fetched items to the persisted item history. The first
+// seen publish date is kept, so items without a date do not move around.
+func SaveFeedItems(category, source string, items []*FeedItem) error {
+	if db == nil || len(items) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixNano()
+	for _, item := range items {
+		if _, err := tx.Exec(
+			`INSERT INTO feed_items (category, source, item_key, title, link, description, author, guid, published_at, fetched_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(category, source, item_key) DO UPDATE SET
+			   title = excluded.title, link = excluded.link, description = excluded.description,
+			   author = excluded.author, fetched_at = excluded.fetched_at`,
+			category, source, feedItemKey(item), item.Title, item.Link, item.Description,
+			item.Author, item.GUID, item.PublishedAt.UnixNano(), now,
+		); err != nil {
+			return fmt.Errorf("failed to save item %q: %w", item.Title, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// itemCursor is the position after the last item of a page
+type itemCursor struct {
+	PublishedAt int64  `json:"p"`
+	Key         string `json:"k"`
+}
+
+func encodeItemCursor(c itemCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeItemCursor(raw string) (itemCursor, error) {
+	var c itemCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, errInvalidCursor
+	}
+	return c, nil
+}
+
+// QueryFeedItems returns a page of a source's item history, newest first.
+// An empty cursor starts at the newest item; the returned cursor is empty
+// when there are no more items.
+func QueryFeedItems(category, source, cursor string, limit int) ([]FeedItem, string, error) {
+	query := `SELECT item_key, title, link, description, author, guid, published_at
+		FROM feed_items WHERE category = ? AND source = ?`
+	args := []any{category, source}
+
+	if cursor != "" {
+		c, err := decodeItemCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query += ` AND (published_at < ? OR (published_at = ? AND item_key < ?))`
+		args = append(args, c.PublishedAt, c.PublishedAt, c.Key)
+	}
+	// Fetch one extra row to know whether another page exists
+	query += ` ORDER BY published_at DESC, item_key DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []FeedItem{}
+	var keys []string
+	var published []int64
+	for rows.Next() {
+		var key string
+		var publishedAt int64
+		item := FeedItem{Source: source, Category: category}
+		if err := rows.Scan(&key, &item.Title, &item.Link, &item.Description, &item.Author, &item.GUID, &publishedAt); err != nil {
+			return nil, "", fmt.Errorf("failed to scan item: %w", err)
+		}
+		item.PublishedAt = time.Unix(0, publishedAt)
+		items = append(items, item)
+		keys = append(keys, key)
+		published = append(published, publishedAt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(items) > limit {
+		items = items[:limit]
+		next = encodeItemCursor(itemCursor{PublishedAt: published[limit-1], Key: keys[limit-1]})
+	}
+	return items, next, nil
+}
+
+// PruneOldItems removes history items older than the retention window
+func PruneOldItems(retentionDays int) error {
+	if retentionDays <= 0 {
+		retentionDays = defaultHistoryRetentionDays
+	}
+	cutoff := time.Now().AddDate(0, 0, -retentionDays).UnixNano()
+	result, err := db.Exec("DELETE FROM feed_items WHERE published_at < ?", cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to prune old items: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+	if deleted > 0 {
+		log.Printf("Pruned %d feed items older than %d days", deleted, retentionDays)
+	}
+	return nil
+}
+
+// PruneWorker removes click events and history items past their retention
+// windows every hour, so a long-running server does not grow without bound
+func PruneWorker(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := PruneOldEvents(Cfg.ML.RetentionDays); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+			if err := PruneOldItems(Cfg.Refresh.HistoryRetentionDays); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+	}
+}
+
+// HandleSourceItems pages through the stored item history of one source:
+// GET /api/sources/{id}/items?cursor=&limit=
+func HandleSourceItems(w http.ResponseWriter, r *http.Request) {
+	category, source, ok := findSource(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	limit := sourceItemsDefaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", raw), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, sourceItemsMaxLimit)
+	}
+
+	items, next, err := QueryFeedItems(category, source, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, errInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to load items for %s:%s: %v", category, source, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"items":      items,
+		"nextCursor": next,
+	})
+}
@@ -0,0 +1,25 @@
+package backend
+
+import "testing"
+
+func TestSourceID(t *testing.T) {
+	tests := []struct {
+		category, source, want string
+	}{
+		{"Tech", "Ars Technica", "tech--ars-technica"},
+		{"a-b", "c", "a-b--c"},
+		{"a", "b-c", "a--b-c"},
+		{" News! ", "--Foo  Bar--", "news--foo-bar"},
+		{"日本", "NHK", "日本--nhk"},
+		{"Новости", "Медуза", "новости--медуза"},
+		{"Новости", "Дождь", "новости--дождь"},
+		{"हिन्दी", "बीबीसी", "हिन्दी--बीबीसी"},
+		{"News", "+++", "news--_29f5099b"},
+		{"News", "***", "news--_596f4162"},
+	}
+	for _, tt := range tests {
+		if got := SourceID(tt.category, tt.source); got != tt.want {
+			t.Errorf("SourceID(%q, %q) = %q, want %q", tt.category, tt.source, got, tt.want)
+		}
+	}
+}
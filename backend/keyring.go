@@ -0,0 +1,420 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultKeyID identifies the legacy DASHBOARD_HMAC_SECRET key and is used
+// when a signature header carries no key ID
+const DefaultKeyID = "default"
+
+// HMACKey is a single signing key. Several keys can be active at once so that
+// clients can be moved to a new key before the old one expires.
+type HMACKey struct {
+	ID        string    `yaml:"id" json:"id"`
+	Secret    string    `yaml:"secret" json:"-"`
+	User      string    `yaml:"user" json:"user"`
+	NotBefore time.Time `yaml:"notBefore" json:"notBefore,omitzero"`
+	ExpiresAt time.Time `yaml:"expiresAt" json:"expiresAt,omitzero"`
+	Revoked   bool      `yaml:"revoked" json:"revoked"`
+	Source    string    `yaml:"-" json:"source"` // env, file or user
+}
+
+// KeyStats tracks verification results for a single key ID
+type KeyStats struct {
+	Successes   int       `json:"successes"`
+	Failures    int       `json:"failures"`
+	LastUsed    time.Time `json:"lastUsed,omitzero"`
+	LastFailure time.Time `json:"lastFailure,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// KeyStatus is the admin view of a key: metadata, state and counters, never the secret
+type KeyStatus struct {
+	HMACKey
+	Status string   `json:"status"`
+	Stats  KeyStats `json:"stats"`
+}
+
+type keyringFile struct {
+	Keys []HMACKey `yaml:"keys"`
+}
+
+// Keyring holds all HMAC keys loaded from the environment and the keyring file
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string]*HMACKey
+	revoked map[string]map[string]bool // key ID -> revoked secret fingerprints (admin API)
+	stats   map[string]*KeyStats
+	path    string
+	modTime time.Time
+	envKeys []HMACKey
+}
+
+var keyring = &Keyring{
+	keys:    map[string]*HMACKey{},
+	revoked: map[string]map[string]bool{},
+	stats:   map[string]*KeyStats{},
+}
+
+// parseEnvKeys reads DASHBOARD_HMAC_SECRET (key "default") and
+// DASHBOARD_HMAC_KEYS ("id=secret,id2=secret2", owned by the default user)
+func parseEnvKeys() ([]HMACKey, error) {
+	var keys []HMACKey
+	if secret := os.Getenv("DASHBOARD_HMAC_SECRET"); secret != "" {
+		keys = append(keys, HMACKey{ID: DefaultKeyID, Secret: secret, User: DefaultUserID, Source: "env"})
+	}
+
+	for _, pair := range strings.Split(os.Getenv("DASHBOARD_HMAC_KEYS"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, "=")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid DASHBOARD_HMAC_KEYS entry %q (expected id=secret)", pair)
+		}
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("DASHBOARD_HMAC_KEYS: key id %q must not contain ':'", id)
+		}
+		keys = append(keys, HMACKey{ID: id, Secret: secret, User: DefaultUserID, Source: "env"})
+	}
+	return keys, nil
+}
+
+// load rebuilds the key set from the environment keys and the keyring file
+func (kr *Keyring) load() error {
+	keys := map[string]*HMACKey{}
+	for i := range kr.envKeys {
+		k := kr.envKeys[i]
+		keys[k.ID] = &k
+	}
+
+	var modTime time.Time
+	if kr.path != "" {
+		info, err := os.Stat(kr.path)
+		if err != nil {
+			return fmt.Errorf("error reading keyring %s: %w", kr.path, err)
+		}
+		modTime = info.ModTime()
+
+		data, err := os.ReadFile(kr.path)
+		if err != nil {
+			return fmt.Errorf("error reading keyring %s: %w", kr.path, err)
+		}
+		var file keyringFile
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("error parsing keyring %s: %w", kr.path, err)
+		}
+		for i := range file.Keys {
+			k := file.Keys[i]
+			if k.ID == "" || k.Secret == "" {
+				return fmt.Errorf("keyring %s: key #%d needs both id and secret", kr.path, i+1)
+			}
+			if strings.Contains(k.ID, ":") {
+				return fmt.Errorf("keyring %s: key id %q must not contain ':'", kr.path, k.ID)
+			}
+			// Signing as the default user grants admin rights, so it has to
+			// be asked for explicitly
+			if k.User == "" {
+				return fmt.Errorf("keyring %s: key %q needs a user (%q for admin access)", kr.path, k.ID, DefaultUserID)
+			}
+			if _, exists := LookupUser(k.User); !exists && k.User != DefaultUserID {
+				return fmt.Errorf("keyring %s: key %q belongs to unknown user %q", kr.path, k.ID, k.User)
+			}
+			k.Source = "file"
+			keys[k.ID] = &k
+		}
+	}
+
+	kr.mu.Lock()
+	kr.keys = keys
+	kr.modTime = modTime
+	kr.mu.Unlock()
+	return nil
+}
+
+// keyFingerprint identifies a secret without storing it
+func keyFingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadRevocations reads keys revoked through the admin API from the database
+func (kr *Keyring) loadRevocations() error {
+	if db == nil {
+		return nil
+	}
+	rows, err := db.Query("SELECT key_id, fingerprint FROM revoked_keys")
+	if err != nil {
+		return fmt.Errorf("failed to load revoked keys: %w", err)
+	}
+	defer rows.Close()
+
+	revoked := map[string]map[string]bool{}
+	for rows.Next() {
+		var id, fingerprint string
+		if err := rows.Scan(&id, &fingerprint); err != nil {
+			return err
+		}
+		if revoked[id] == nil {
+			revoked[id] = map[string]bool{}
+		}
+		revoked[id][fingerprint] = true
+	}
+
+	kr.mu.Lock()
+	kr.revoked = revoked
+	kr.mu.Unlock()
+	return rows.Err()
+}
+
+// isRevoked reports whether this secret of a key ID was revoked through the
+// admin API. Revocations from before fingerprints (empty) cover every secret.
+// The caller holds kr.mu.
+func (kr *Keyring) isRevoked(id, secret string) bool {
+	fingerprints := kr.revoked[id]
+	return fingerprints[""] || fingerprints[keyFingerprint(secret)]
+}
+
+// Configured reports whether any key or user profile can authenticate requests
+func (kr *Keyring) Configured() bool {
+	kr.mu.RLock()
+	n := len(kr.keys)
+	kr.mu.RUnlock()
+	return n > 0 || HasUsers()
+}
+
+// Resolve returns the key for an ID if it may currently be used to sign.
+// User profile secrets are resolved as keys whose ID is the user ID.
+func (kr *Keyring) Resolve(id string) (*HMACKey, string) {
+	kr.mu.RLock()
+	k, ok := kr.keys[id]
+	kr.mu.RUnlock()
+
+	if !ok {
+		u, found := LookupUser(id)
+		if !found {
+			return nil, "unknown key"
+		}
+		k = &HMACKey{ID: u.ID, Secret: u.Secret, User: u.ID, Source: "user"}
+	} else if _, exists := LookupUser(k.User); !exists && k.User != DefaultUserID {
+		// The user was deleted after the keyring was loaded
+		return nil, "key user deleted"
+	}
+
+	kr.mu.RLock()
+	revoked := kr.isRevoked(id, k.Secret)
+	kr.mu.RUnlock()
+
+	if status := keyState(k, revoked, time.Now()); status != "active" {
+		return nil, "key " + status
+	}
+	return k, ""
+}
+
+func keyState(k *HMACKey, revoked bool, now time.Time) string {
+	switch {
+	case k.Revoked || revoked:
+		return "revoked"
+	case !k.NotBefore.IsZero() && now.Before(k.NotBefore):
+		return "not yet active"
+	case !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt):
+		return "expired"
+	}
+	return "active"
+}
+
+// record updates the per-key counters. Only known key IDs are tracked so
+// that random IDs sent by clients cannot grow the map.
+func (kr *Keyring) record(id string, errMsg string) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if _, ok := kr.keys[id]; !ok {
+		if _, isUser := LookupUser(id); !isUser {
+			return
+		}
+	}
+
+	stats := kr.stats[id]
+	if stats == nil {
+		stats = &KeyStats{}
+		kr.stats[id] = stats
+	}
+
+	now := time.Now()
+	if errMsg == "" {
+		stats.Successes++
+		stats.LastUsed = now
+		return
+	}
+	stats.Failures++
+	stats.LastFailure = now
+	stats.LastError = errMsg
+}
+
+// Revoke revokes the current secret of a key and persists the revocation.
+// Only the secret's fingerprint is stored, so a new secret rotated in under
+// the same key ID is accepted again.
+func (kr *Keyring) Revoke(id string) error {
+	kr.mu.RLock()
+	k, ok := kr.keys[id]
+	kr.mu.RUnlock()
+	var secret string
+	if ok {
+		secret = k.Secret
+	} else {
+		u, isUser := LookupUser(id)
+		if !isUser {
+			return fmt.Errorf("key %q not found", id)
+		}
+		secret = u.Secret
+	}
+	fingerprint := keyFingerprint(secret)
+
+	if _, err := db.Exec(
+		"INSERT INTO revoked_keys (key_id, fingerprint, revoked_at) VALUES (?, ?, ?) ON CONFLICT(key_id, fingerprint) DO NOTHING",
+		id, fingerprint, time.Now(),
+	); err != nil {
+		return fmt.Errorf("failed to persist revocation: %w", err)
+	}
+
+	kr.mu.Lock()
+	if kr.revoked[id] == nil {
+		kr.revoked[id] = map[string]bool{}
+	}
+	kr.revoked[id][fingerprint] = true
+	kr.mu.Unlock()
+	return nil
+}
+
+// Reinstate lifts all admin API revocations of a key ID. Keys marked
+// revoked in the keyring file stay revoked.
+func (kr *Keyring) Reinstate(id string) error {
+	result, err := db.Exec("DELETE FROM revoked_keys WHERE key_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete revocation: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("key %q is not revoked", id)
+	}
+
+	kr.mu.Lock()
+	delete(kr.revoked, id)
+	kr.mu.Unlock()
+	return nil
+}
+
+// Status lists all keys (keyring and user profiles) with their state and counters
+func (kr *Keyring) Status() []KeyStatus {
+	now := time.Now()
+	var result []KeyStatus
+
+	kr.mu.RLock()
+	for _, k := range kr.keys {
+		s := KeyStatus{HMACKey: *k, Status: keyState(k, kr.isRevoked(k.ID, k.Secret), now)}
+		if stats := kr.stats[k.ID]; stats != nil {
+			s.Stats = *stats
+		}
+		result = append(result, s)
+	}
+	for _, u := range ListUsers() {
+		if _, shadowed := kr.keys[u.ID]; shadowed {
+			continue
+		}
+		k := &HMACKey{ID: u.ID, User: u.ID, Source: "user"}
+		s := KeyStatus{HMACKey: *k, Status: keyState(k, kr.isRevoked(u.ID, u.Secret), now)}
+		if stats := kr.stats[u.ID]; stats != nil {
+			s.Stats = *stats
+		}
+		result = append(result, s)
+	}
+	kr.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// WatchKeyring reloads the keyring file when it changes so keys can be
+// rotated without a restart
+func WatchKeyring(ctx context.Context) {
+	if keyring.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(keyring.path)
+			if err != nil {
+				log.Printf("Warning: cannot stat keyring %s: %v", keyring.path, err)
+				continue
+			}
+
+			keyring.mu.RLock()
+			changed := !info.ModTime().Equal(keyring.modTime)
+			keyring.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := keyring.load(); err != nil {
+				log.Printf("Warning: keeping previous keyring: %v", err)
+				continue
+			}
+			log.Printf("Reloaded HMAC keyring from %s", keyring.path)
+		}
+	}
+}
+
+// HandleAdminKeys lists keys with per-key failure counts (GET), revokes a
+// key (DELETE ?id=) and reinstates a revoked key (PUT ?id=)
+func HandleAdminKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keyring.Status())
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if err := keyring.Revoke(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Revoked HMAC key %q", id)
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodPut:
+		id := r.URL.Query().Get("id")
+		if err := keyring.Reinstate(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Reinstated HMAC key %q", id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
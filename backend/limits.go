@@ -0,0 +1,236 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultRoutePolicies are used for any route or field not set in
+// server.limits. Every route registered with RoutePolicyMiddleware must be
+// listed here, and server.limits.routes may only name these routes.
+var defaultRoutePolicies = map[string]RoutePolicy{
+	// Read endpoints: 300 requests/minute per IP
+	"/api/dashboard": {RatePerMinute: 300},
+	"/api/session":   {RatePerMinute: 300},
+	// RSS/Atom/JSON Feed output for external readers
+	"GET /api/feeds/category/{category}":        {RatePerMinute: 300},
+	"GET /api/feeds/source/{category}/{source}": {RatePerMinute: 300},
+	"GET /api/feeds/top":                        {RatePerMinute: 300},
+	"GET /api/sources/{id}/items":               {RatePerMinute: 300},
+	// Write endpoints: 120 requests/minute per IP
+	"/api/feedback":    {RatePerMinute: 120, MaxBodyBytes: 1024 * 10, RequireHMAC: boolPtr(true)},
+	"/api/logout":      {RatePerMinute: 120},
+	"/api/admin/users": {RatePerMinute: 120, MaxBodyBytes: 1024 * 10, RequireHMAC: boolPtr(true)},
+	"/api/admin/keys":  {RatePerMinute: 120, RequireHMAC: boolPtr(true)},
+	"GET /api/opml":    {RatePerMinute: 120},
+	"POST /api/opml":   {RatePerMinute: 120, MaxBodyBytes: 1024 * 1024, RequireHMAC: boolPtr(true)},
+	// Database download: each request writes a full copy of the database
+	"GET /api/admin/backup": {RatePerMinute: 6, RequireHMAC: boolPtr(true)},
+	// Learned preferences as portable JSON
+	"GET /api/ml/export":  {RatePerMinute: 30, RequireHMAC: boolPtr(true)},
+	"POST /api/ml/import": {RatePerMinute: 10, MaxBodyBytes: 64 << 20, RequireHMAC: boolPtr(true)},
+	// Browser CSP violation reports
+	"POST /api/csp-report": {RatePerMinute: 60, MaxBodyBytes: 1024 * 16},
+	// Login: 10 requests/minute per IP to slow down secret guessing
+	"/api/login": {RatePerMinute: 10, MaxBodyBytes: 1024 * 10},
+}
+
+// authenticatedRoutes serve only authenticated users (mostly admins), so
+// server.limits.routes may not set requireHMAC: false on them
+var authenticatedRoutes = map[string]bool{
+	"/api/admin/users":      true,
+	"/api/admin/keys":       true,
+	"GET /api/admin/backup": true,
+	"POST /api/opml":        true,
+	"GET /api/ml/export":    true,
+	"POST /api/ml/import":   true,
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// routeLimits is the compiled, immutable form of server.limits. It is
+// swapped atomically on config reload.
+type routeLimits struct {
+	allowlist []netip.Prefix
+	routes    map[string]RoutePolicy
+}
+
+var currentLimits atomic.Pointer[routeLimits]
+
+func init() {
+	currentLimits.Store(&routeLimits{routes: defaultRoutePolicies})
+}
+
+// mergeRoutePolicy overlays the fields set in override onto base
+func mergeRoutePolicy(base, override RoutePolicy) RoutePolicy {
+	if override.RatePerMinute != 0 {
+		base.RatePerMinute = override.RatePerMinute
+	}
+	if override.Burst != 0 {
+		base.Burst = override.Burst
+	}
+	if override.MaxBodyBytes != 0 {
+		base.MaxBodyBytes = override.MaxBodyBytes
+	}
+	if override.RequireHMAC != nil {
+		base.RequireHMAC = override.RequireHMAC
+	}
+	return base
+}
+
+// ApplyLimits compiles server.limits and makes it active for all routes
+func ApplyLimits(cfg LimitsConfig) error {
+	compiled, err := compileLimits(cfg)
+	if err != nil {
+		return err
+	}
+	currentLimits.Store(compiled)
+	return nil
+}
+
+func compileLimits(cfg LimitsConfig) (*routeLimits, error) {
+	compiled := &routeLimits{routes: map[string]RoutePolicy{}}
+
+	for _, entry := range cfg.Allowlist {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+			}
+			compiled.allowlist = append(compiled.allowlist, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+		}
+		compiled.allowlist = append(compiled.allowlist, prefix.Masked())
+	}
+
+	for route, policy := range defaultRoutePolicies {
+		compiled.routes[route] = policy
+	}
+	for route, policy := range cfg.Routes {
+		if _, ok := defaultRoutePolicies[route]; !ok {
+			return nil, fmt.Errorf("unknown route %q%s", route, routeHint(route))
+		}
+		if policy.RatePerMinute < 0 || policy.Burst < 0 || policy.MaxBodyBytes < 0 {
+			return nil, fmt.Errorf("route %s: limits must not be negative", route)
+		}
+		if authenticatedRoutes[route] && policy.RequireHMAC != nil && !*policy.RequireHMAC {
+			return nil, fmt.Errorf("route %s: requireHMAC cannot be disabled, the route needs an authenticated user", route)
+		}
+		compiled.routes[route] = mergeRoutePolicy(compiled.routes[route], policy)
+	}
+
+	return compiled, nil
+}
+
+// routeHint suggests the registered routes a mistyped route key may mean,
+// e.g. "GET /api/opml" and "POST /api/opml" for "/api/opml"
+func routeHint(route string) string {
+	path := route
+	if _, p, ok := strings.Cut(route, " "); ok {
+		path = p
+	}
+	var matches []string
+	for known := range defaultRoutePolicies {
+		knownPath := known
+		if _, p, ok := strings.Cut(known, " "); ok {
+			knownPath = p
+		}
+		if strings.EqualFold(knownPath, path) {
+			matches = append(matches, strconv.Quote(known))
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	slices.Sort(matches)
+	return fmt.Sprintf(" (did you mean %s?)", strings.Join(matches, " or "))
+}
+
+func (l *routeLimits) allowlisted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.allowlist {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoutePolicyMiddleware applies the server.limits policy of a route: rate
+// limiting (skipped for allowlisted IPs), request body size and whether
+// authentication is required. The policy is looked up on every request so
+// config reloads take effect immediately.
+func RoutePolicyMiddleware(route string, handler http.Handler) http.Handler {
+	if _, ok := defaultRoutePolicies[route]; !ok {
+		panic("no default policy for route " + route)
+	}
+	limiter := NewRateLimiter()
+	required := RequireAuth(handler, true)
+	optional := OptionalAuth(handler)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits := currentLimits.Load()
+		policy := limits.routes[route]
+
+		clientIP := GetClientIP(r)
+		if policy.RatePerMinute > 0 && !limits.allowlisted(clientIP) {
+			result := limiter.Allow(rateLimitKey(clientIP), policy.RatePerMinute, policy.Burst)
+			setRateLimitHeaders(w, result)
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		if policy.MaxBodyBytes > 0 {
+			if r.ContentLength > policy.MaxBodyBytes {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, policy.MaxBodyBytes)
+		}
+
+		if policy.RequireHMAC != nil && *policy.RequireHMAC {
+			required.ServeHTTP(w, r)
+			return
+		}
+		optional.ServeHTTP(w, r)
+	})
+}
+
+// reloadLimits applies the hot-reloadable parts of a freshly parsed config
+func reloadLimits(cfg Config) error {
+	if err := SetTrustedProxies(cfg.Server.TrustedProxies, cfg.Server.ForwardedHeader); err != nil {
+		return fmt.Errorf("invalid server.trustedProxies: %w", err)
+	}
+	if err := ApplyLimits(cfg.Server.Limits); err != nil {
+		return fmt.Errorf("invalid server.limits: %w", err)
+	}
+	if err := ApplyCORS(cfg.Server.CORS); err != nil {
+		return fmt.Errorf("invalid server.cors: %w", err)
+	}
+	if err := ApplySecurity(cfg.Server.Security); err != nil {
+		return fmt.Errorf("invalid server.security: %w", err)
+	}
+	log.Printf("Applied server.limits (%d routes, %d allowlisted ranges)", len(currentLimits.Load().routes), len(currentLimits.Load().allowlist))
+	return nil
+}
@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// userFilter returns a WHERE clause limiting a query to one user ("" = all)
+func userFilter(userID string) (string, []any) {
+	if userID == "" {
+		return "", nil
+	}
+	return " WHERE user_id = ?", []any{userID}
+}
+
+// ResetPreferences deletes the learned weights and click history of a user
+// ("" for all users)
+func ResetPreferences(userID string) (int64, int64, error) {
+	where, args := userFilter(userID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	weights, err := tx.Exec("DELETE FROM token_weights"+where, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete token weights: %w", err)
+	}
+	events, err := tx.Exec("DELETE FROM click_events"+where, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete click events: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	nWeights, _ := weights.RowsAffected()
+	nEvents, _ := events.RowsAffected()
+	return nWeights, nEvents, LoadTokenWeights()
+}
+
+// RetrainTokenWeights rebuilds the token weights of a user ("" for all
+// users) from the stored click history, as if every click had been learned
+// with the current ml.clickWeight and decayed by ml.tokenDecayPerDay since.
+// It returns the number of clicks replayed.
+func RetrainTokenWeights(userID string) (int, error) {
+	where, args := userFilter(userID)
+	rows, err := db.Query("SELECT user_id, title, clicked_at FROM click_events"+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read click events: %w", err)
+	}
+
+	now := time.Now()
+	decay := Cfg.ML.TokenDecayPerDay
+	weights := map[string]map[string]float64{}
+	clicks := 0
+	for rows.Next() {
+		var user, title string
+		var clickedAt time.Time
+		if err := rows.Scan(&user, &title, &clickedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan click event: %w", err)
+		}
+		clicks++
+
+		tokens := Tokenize(title)
+		if len(tokens) == 0 {
+			continue
+		}
+		weight := Cfg.ML.ClickWeight / float64(len(tokens))
+		if decay > 0 && decay < 1 {
+			weight *= math.Pow(decay, now.Sub(clickedAt).Hours()/24)
+		}
+		if weights[user] == nil {
+			weights[user] = map[string]float64{}
+		}
+		for _, token := range tokens {
+			weights[user][token] += weight
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM token_weights"+where, args...); err != nil {
+		return 0, fmt.Errorf("failed to delete token weights: %w", err)
+	}
+	for user, tokens := range weights {
+		for token, weight := range tokens {
+			if _, err := tx.Exec(
+				`INSERT INTO token_weights (user_id, token, weight, updated_at) VALUES (?, ?, ?, ?)`,
+				user, token, weight, now,
+			); err != nil {
+				return 0, fmt.Errorf("failed to save token weight %q: %w", token, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return clicks, LoadTokenWeights()
+}
+
+// VacuumStore rebuilds the database file, reclaiming space from deleted rows
+func VacuumStore() error {
+	if _, err := db.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
+
+// BackupStore writes a consistent copy of the database to path while it
+// stays in use. The target must not exist.
+func BackupStore(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package backend
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQL migrations are named <version>_<name>.sql, e.g. 0003_feed_items.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is one numbered schema change, either SQL or Go code
+type migration struct {
+	version int
+	name    string
+	sql     string
+	up      func(tx *sql.Tx) error
+}
+
+// goMigrations are schema changes that need more than plain SQL
+var goMigrations = []migration{
+	{version: 2, name: "per_user_preferences", up: migrateUserColumns},
+}
+
+// loadMigrations returns all migrations ordered by version
+func loadMigrations() ([]migration, error) {
+	return readMigrations(migrationFiles, goMigrations)
+}
+
+// readMigrations combines the SQL files in the migrations directory of fsys
+// with the Go migrations, ordered by version
+func readMigrations(fsys fs.FS, goMigrations []migration) ([]migration, error) {
+	migrations := append([]migration{}, goMigrations...)
+
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s (expected <version>_<name>.sql)", e.Name())
+		}
+		data, err := fs.ReadFile(fsys, path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version %d (%s, %s)", migrations[i].version, migrations[i-1].name, migrations[i].name)
+		}
+	}
+	return migrations, nil
+}
+
+// SchemaVersion returns the version of the open database and the latest
+// version known to this binary
+func SchemaVersion() (int, int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return 0, 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return current, migrations[len(migrations)-1].version, nil
+}
+
+// migrate applies pending migrations, each in its own transaction together
+// with its schema_migrations row. A database written by a newer binary is
+// refused rather than used with a schema this code does not know.
+//
+// The transactions are IMMEDIATE and re-read the schema version, so when two
+// processes open the database at once (e.g. the server and "db migrate"),
+// the second waits for the first and skips what it already applied.
+func migrate(dbPath string) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	mdb, err := sql.Open("sqlite", "file:"+dbPath+"?_txlock=immediate&_pragma=busy_timeout(30000)")
+	if err != nil {
+		return err
+	}
+	defer mdb.Close()
+	mdb.SetMaxOpenConns(1)
+
+	if _, err := mdb.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := mdb.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if latest := migrations[len(migrations)-1].version; current > latest {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d); upgrade the dashboard", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		applied, err := applyMigration(mdb, m)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		if applied {
+			log.Printf("Applied migration %d (%s)", m.version, m.name)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs m unless another process applied it since the schema
+// version was read, and reports whether it ran
+func applyMigration(mdb *sql.DB, m migration) (bool, error) {
+	tx, err := mdb.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if m.version <= current {
+		return false, nil
+	}
+
+	if m.up != nil {
+		err = m.up(tx)
+	} else {
+		_, err = tx.Exec(m.sql)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.version, m.name, time.Now(),
+	); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// migrateUserColumns upgrades databases created before multi-user support.
+// Existing clicks and weights are assigned to the default user.
+func migrateUserColumns(tx *sql.Tx) error {
+	hasColumn := func(table, column string) (bool, error) {
+		rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+		if err != nil {
+			return false, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				cid       int
+				name      string
+				colType   string
+				notNull   int
+				dfltValue sql.NullString
+				pk        int
+			)
+			if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+				return false, err
+			}
+			if name == column {
+				return true, nil
+			}
+		}
+		return false, rows.Err()
+	}
+
+	ok, err := hasColumn("click_events", "user_id")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if _, err := tx.Exec(`ALTER TABLE click_events ADD COLUMN user_id TEXT NOT NULL DEFAULT 'default'`); err != nil {
+			return err
+		}
+	}
+
+	ok, err = hasColumn("token_weights", "user_id")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// The primary key changes, so token_weights has to be rebuilt
+		if _, err := tx.Exec(`
+			ALTER TABLE token_weights RENAME TO token_weights_old;
+
+			CREATE TABLE token_weights (
+				user_id    TEXT NOT NULL DEFAULT 'default',
+				token      TEXT NOT NULL,
+				weight     REAL NOT NULL,
+				updated_at DATETIME NOT NULL,
+				PRIMARY KEY (user_id, token)
+			);
+
+			INSERT INTO token_weights (user_id, token, weight, updated_at)
+			SELECT 'default', token, weight, updated_at FROM token_weights_old;
+
+			DROP TABLE token_weights_old;
+		`); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_click_events_user ON click_events (user_id)`)
+	return err
+}
@@ -0,0 +1,32 @@
+-- Tables of the original schema. IF NOT EXISTS lets databases created
+-- before migrations were tracked adopt this version unchanged.
+CREATE TABLE IF NOT EXISTS click_events (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id    TEXT NOT NULL DEFAULT 'default',
+	item_key   TEXT NOT NULL,
+	title      TEXT NOT NULL,
+	link       TEXT NOT NULL,
+	source     TEXT NOT NULL,
+	category   TEXT NOT NULL,
+	clicked_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS token_weights (
+	user_id    TEXT NOT NULL DEFAULT 'default',
+	token      TEXT NOT NULL,
+	weight     REAL NOT NULL,
+	updated_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, token)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id         TEXT PRIMARY KEY,
+	secret     TEXT NOT NULL,
+	is_admin   INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS revoked_keys (
+	key_id     TEXT PRIMARY KEY,
+	revoked_at DATETIME NOT NULL
+);
@@ -0,0 +1,16 @@
+-- Item history per source; times are unix nanoseconds so they sort correctly
+CREATE TABLE IF NOT EXISTS feed_items (
+	category     TEXT NOT NULL,
+	source       TEXT NOT NULL,
+	item_key     TEXT NOT NULL,
+	title        TEXT NOT NULL,
+	link         TEXT NOT NULL,
+	description  TEXT NOT NULL,
+	author       TEXT NOT NULL,
+	guid         TEXT NOT NULL,
+	published_at INTEGER NOT NULL,
+	fetched_at   INTEGER NOT NULL,
+	PRIMARY KEY (category, source, item_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_feed_items_published ON feed_items (category, source, published_at DESC, item_key DESC);
@@ -0,0 +1,2 @@
+-- PruneOldEvents deletes by clicked_at
+CREATE INDEX IF NOT EXISTS idx_click_events_clicked_at ON click_events (clicked_at);
@@ -0,0 +1,15 @@
+-- Revocations apply to one secret of a key ID, so a new secret rotated in
+-- under the same ID works again. Older revocations (empty fingerprint) keep
+-- covering every secret of their key ID until reinstated.
+CREATE TABLE revoked_keys_new (
+	key_id      TEXT NOT NULL,
+	fingerprint TEXT NOT NULL DEFAULT '',
+	revoked_at  DATETIME NOT NULL,
+	PRIMARY KEY (key_id, fingerprint)
+);
+
+INSERT INTO revoked_keys_new (key_id, fingerprint, revoked_at)
+SELECT key_id, '', revoked_at FROM revoked_keys;
+
+DROP TABLE revoked_keys;
+ALTER TABLE revoked_keys_new RENAME TO revoked_keys;
@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadMigrations(t *testing.T) {
+	goUp := []migration{{version: 2, name: "go_change"}}
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []int
+		wantErr string
+	}{
+		{
+			name: "SQL and Go migrations ordered by version",
+			files: fstest.MapFS{
+				"migrations/0010_late.sql":  file("SELECT 10"),
+				"migrations/0001_first.sql": file("SELECT 1"),
+				"migrations/3_short.sql":    file("SELECT 3"),
+			},
+			want: []int{1, 2, 3, 10},
+		},
+		{
+			name:    "duplicate of a Go migration",
+			files:   fstest.MapFS{"migrations/0002_other.sql": file("SELECT 2")},
+			wantErr: "duplicate migration version 2",
+		},
+		{
+			name:    "name without version",
+			files:   fstest.MapFS{"migrations/initial.sql": file("SELECT 1")},
+			wantErr: "invalid migration file name initial.sql",
+		},
+		{
+			name:    "version zero",
+			files:   fstest.MapFS{"migrations/0000_zero.sql": file("SELECT 0")},
+			wantErr: "invalid migration file name 0000_zero.sql",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := readMigrations(tt.files, goUp)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readMigrations() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, m := range migrations {
+				got = append(got, m.version)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("versions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The embedded migrations must number the schema 1, 2, 3... without gaps
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Fatalf("migration %d (%s) has version %d, want %d", i, m.name, m.version, i+1)
+		}
+		if (m.sql == "") == (m.up == nil) {
+			t.Errorf("migration %d (%s) needs exactly one of SQL or Go code", m.version, m.name)
+		}
+	}
+}
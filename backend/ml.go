@@ -6,37 +6,54 @@ import (
 	"time"
 )
 
-func ScoreItem(item *FeedItem) float64 {
-	return tokenAffinityScore(Tokenize(item.Title))
+func ScoreItem(userID string, item *FeedItem) float64 {
+	return tokenAffinityScore(userID, Tokenize(item.Title))
 }
 
 // tokenAffinityScore computes the dot product between an item's tokens and
 // the user's learned token preference weights. Higher means more relevant
 // to what the user has clicked before.
-func tokenAffinityScore(words []string) float64 {
+func tokenAffinityScore(userID string, words []string) float64 {
 	TokenWeightMu.RLock()
 	defer TokenWeightMu.RUnlock()
 
+	weights := TokenWeights[userID]
 	score := 0.0
 	for _, w := range words {
-		if weight, ok := TokenWeights[w]; ok {
+		if weight, ok := weights[w]; ok {
 			score += weight
 		}
 	}
 	return score
 }
 
-// GetTopRatedItems returns strict top-N scored items globally across all feeds.
-func GetTopRatedItems(limit int) []TopRatedItem {
+// GetTopRatedItems returns strict top-N scored items across all feeds for a user.
+func GetTopRatedItems(userID string, limit int) []TopRatedItem {
+	ranked := RankItems(userID, limit)
+
+	result := make([]TopRatedItem, 0, len(ranked))
+	for _, item := range ranked {
+		result = append(result, TopRatedItem{
+			Link:  item.Link,
+			Score: item.Score,
+		})
+	}
+
+	return result
+}
+
+// RankItems returns the top-N recent items across all feeds for a user, with
+// Score set. Users without learned preferences get an empty list.
+func RankItems(userID string, limit int) []FeedItem {
 	if limit <= 0 {
-		return []TopRatedItem{}
+		return []FeedItem{}
 	}
 
 	TokenWeightMu.RLock()
-	hasWeights := len(TokenWeights) > 0
+	hasWeights := len(TokenWeights[userID]) > 0
 	TokenWeightMu.RUnlock()
 	if !hasWeights {
-		return []TopRatedItem{}
+		return []FeedItem{}
 	}
 
 	allFeeds := GetAllFeeds()
@@ -53,33 +70,19 @@ func GetTopRatedItems(limit int) []TopRatedItem {
 		}
 	}
 
-	type scoredItem struct {
-		item  FeedItem
-		score float64
+	for i := range allItems {
+		allItems[i].Score = ScoreItem(userID, &allItems[i])
 	}
 
-	scored := make([]scoredItem, 0, len(allItems))
-	for _, item := range allItems {
-		scored = append(scored, scoredItem{item: item, score: ScoreItem(&item)})
-	}
-
-	sort.Slice(scored, func(i, j int) bool {
-		return scored[i].score > scored[j].score
+	sort.Slice(allItems, func(i, j int) bool {
+		return allItems[i].Score > allItems[j].Score
 	})
 
-	if len(scored) > limit {
-		scored = scored[:limit]
+	if len(allItems) > limit {
+		allItems = allItems[:limit]
 	}
 
-	result := make([]TopRatedItem, 0, len(scored))
-	for _, s := range scored {
-		result = append(result, TopRatedItem{
-			Link:  s.item.Link,
-			Score: s.score,
-		})
-	}
-
-	return result
+	return allItems
 }
 
 // Tokenize splits text into meaningful words
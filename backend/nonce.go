@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"container/heap"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const defaultNonceCacheSize = 10000
+
+var noncePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+// NonceCache remembers recently used request nonces so that a captured
+// signed request cannot be replayed inside the timestamp window. Entries
+// expire once the window has passed. Every key ID has its own capacity, so
+// one busy (or hostile) key holder cannot lock out the others.
+type NonceCache struct {
+	mu       sync.Mutex
+	keys     map[string]*keyNonces
+	capacity int // per key ID
+}
+
+// keyNonces are the unexpired nonces of one key ID
+type keyNonces struct {
+	seen    map[string]bool
+	expires nonceHeap
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// nonceHeap orders entries by expiry, which the TTL of a config reload can
+// make differ from insertion order
+type nonceHeap []nonceEntry
+
+func (h nonceHeap) Len() int           { return len(h) }
+func (h nonceHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h nonceHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *nonceHeap) Push(x any)        { *h = append(*h, x.(nonceEntry)) }
+func (h *nonceHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+var nonceCache = NewNonceCache(defaultNonceCacheSize)
+
+// NewNonceCache creates a nonce cache holding at most capacity entries per key ID
+func NewNonceCache(capacity int) *NonceCache {
+	return &NonceCache{
+		keys:     make(map[string]*keyNonces),
+		capacity: capacity,
+	}
+}
+
+// Use records a nonce for a key and reports why it was rejected, if it was.
+// A key whose share of the cache is full has its new nonces rejected rather
+// than forgetting unexpired ones.
+func (nc *NonceCache) Use(keyID, nonce string, ttl time.Duration) (bool, string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	now := time.Now()
+	nc.evictExpired(now)
+
+	kn := nc.keys[keyID]
+	if kn == nil {
+		kn = &keyNonces{seen: make(map[string]bool)}
+		nc.keys[keyID] = kn
+	}
+	if kn.seen[nonce] {
+		return false, "nonce already used"
+	}
+	if len(kn.seen) >= nc.capacity {
+		return false, "too many recent requests, retry later"
+	}
+
+	kn.seen[nonce] = true
+	heap.Push(&kn.expires, nonceEntry{nonce: nonce, expires: now.Add(ttl)})
+	return true, ""
+}
+
+func (nc *NonceCache) evictExpired(now time.Time) {
+	for keyID, kn := range nc.keys {
+		for kn.expires.Len() > 0 && now.After(kn.expires[0].expires) {
+			delete(kn.seen, heap.Pop(&kn.expires).(nonceEntry).nonce)
+		}
+		if len(kn.seen) == 0 {
+			delete(nc.keys, keyID)
+		}
+	}
+}
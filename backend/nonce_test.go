@@ -0,0 +1,36 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNonceCache(t *testing.T) {
+	nc := NewNonceCache(2)
+
+	if ok, msg := nc.Use("a", "nonce-1", time.Hour); !ok {
+		t.Fatalf("first nonce rejected: %s", msg)
+	}
+	if ok, _ := nc.Use("a", "nonce-1", time.Hour); ok {
+		t.Error("replayed nonce was accepted")
+	}
+	if ok, _ := nc.Use("b", "nonce-1", time.Hour); !ok {
+		t.Error("the same nonce of another key was rejected")
+	}
+
+	// A shorter TTL (e.g. after a config reload) expires before older entries
+	if ok, _ := nc.Use("a", "nonce-2", -time.Second); !ok {
+		t.Fatal("second nonce rejected")
+	}
+	if ok, msg := nc.Use("a", "nonce-3", time.Hour); !ok {
+		t.Errorf("expired entry behind a longer-lived one was not evicted: %s", msg)
+	}
+
+	// Key a is now full, which must not affect key b
+	if ok, _ := nc.Use("a", "nonce-4", time.Hour); ok {
+		t.Error("nonce beyond the per-key capacity was accepted")
+	}
+	if ok, msg := nc.Use("b", "nonce-2", time.Hour); !ok {
+		t.Errorf("a full key locked out another key: %s", msg)
+	}
+}
@@ -0,0 +1,394 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// importedCategory receives OPML feeds that are not nested in a folder
+const importedCategory = "imported"
+
+// importedCategoryColor is used for categories created by an import
+const importedCategoryColor = "#9e9e9e"
+
+type opmlDocument struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Head    opmlHead      `xml:"head"`
+	Body    []opmlOutline `xml:"body>outline"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// OPMLImportResult summarizes a merge of OPML subscriptions into the config
+type OPMLImportResult struct {
+	Added      []string `json:"added"`
+	Duplicates []string `json:"duplicates"`
+	Categories []string `json:"createdCategories"`
+	// Sources skipped because their URL is not an absolute http(s) URL
+	Invalid []string `json:"invalid"`
+}
+
+// ExportOPML renders feed categories as an OPML 2.0 document with one
+// folder outline per category
+func ExportOPML(feeds []FeedCategory) ([]byte, error) {
+	doc := opmlDocument{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       "Dashboard subscriptions",
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, category := range feeds {
+		folder := opmlOutline{Text: category.Category, Title: category.Category}
+		for _, source := range category.Sources {
+			folder.Outlines = append(folder.Outlines, opmlOutline{
+				Text:    source.Name,
+				Title:   source.Name,
+				Type:    "rss",
+				XMLURL:  source.URL,
+				HTMLURL: source.Site,
+			})
+		}
+		doc.Body = append(doc.Body, folder)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// ParseOPML reads an OPML document into categories. Nested folders are
+// flattened into their top-level folder; loose feeds go to "imported".
+func ParseOPML(r io.Reader) ([]FeedCategory, error) {
+	var doc opmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing OPML: %w", err)
+	}
+
+	var categories []FeedCategory
+	index := map[string]int{}
+	add := func(categoryName string, o opmlOutline) {
+		i, ok := index[categoryName]
+		if !ok {
+			i = len(categories)
+			index[categoryName] = i
+			categories = append(categories, FeedCategory{Category: categoryName})
+		}
+		name := o.Title
+		if name == "" {
+			name = o.Text
+		}
+		if name == "" {
+			name = o.XMLURL
+		}
+		categories[i].Sources = append(categories[i].Sources, FeedSource{Name: name, URL: o.XMLURL, Site: o.HTMLURL})
+	}
+
+	var walk func(categoryName string, outlines []opmlOutline)
+	walk = func(categoryName string, outlines []opmlOutline) {
+		for _, o := range outlines {
+			if o.XMLURL != "" {
+				add(categoryName, o)
+			}
+			walk(categoryName, o.Outlines)
+		}
+	}
+
+	for _, o := range doc.Body {
+		if o.XMLURL != "" {
+			add(importedCategory, o)
+			continue
+		}
+		folder := o.Text
+		if folder == "" {
+			folder = o.Title
+		}
+		if folder == "" {
+			folder = importedCategory
+		}
+		walk(folder, o.Outlines)
+	}
+
+	return categories, nil
+}
+
+// normalizeFeedURL makes URLs comparable for duplicate detection
+func normalizeFeedURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return strings.TrimSpace(raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.Fragment = ""
+	return u.String()
+}
+
+// MergeFeeds adds imported sources to existing categories, skipping URLs
+// that are already subscribed anywhere. The existing slice is not modified.
+func MergeFeeds(existing, imported []FeedCategory) ([]FeedCategory, OPMLImportResult) {
+	result := OPMLImportResult{Added: []string{}, Duplicates: []string{}, Categories: []string{}, Invalid: []string{}}
+
+	merged := make([]FeedCategory, len(existing))
+	seen := map[string]bool{}
+	for i, category := range existing {
+		merged[i] = category
+		merged[i].Sources = append([]FeedSource{}, category.Sources...)
+		for _, source := range category.Sources {
+			seen[normalizeFeedURL(source.URL)] = true
+		}
+	}
+
+	for _, category := range imported {
+		ci := -1
+		for i := range merged {
+			if strings.EqualFold(merged[i].Category, category.Category) {
+				ci = i
+				break
+			}
+		}
+
+		for _, source := range category.Sources {
+			if !validHTTPURL(source.URL) {
+				result.Invalid = append(result.Invalid, source.URL)
+				continue
+			}
+			key := normalizeFeedURL(source.URL)
+			if seen[key] {
+				result.Duplicates = append(result.Duplicates, source.URL)
+				continue
+			}
+			seen[key] = true
+
+			if ci < 0 {
+				merged = append(merged, FeedCategory{Category: category.Category, Color: importedCategoryColor})
+				ci = len(merged) - 1
+				result.Categories = append(result.Categories, category.Category)
+			}
+
+			// Source IDs are part of API paths and must be unique, so names
+			// that only differ in case or punctuation get a suffix too
+			name := source.Name
+			for n := 2; sourceIDTaken(merged, merged[ci].Category, name); n++ {
+				name = fmt.Sprintf("%s (%d)", source.Name, n)
+			}
+			source.Name = name
+
+			merged[ci].Sources = append(merged[ci].Sources, source)
+			result.Added = append(result.Added, fmt.Sprintf("%s:%s", merged[ci].Category, source.Name))
+		}
+	}
+
+	return merged, result
+}
+
+func sourceIDTaken(feeds []FeedCategory, category, name string) bool {
+	id := SourceID(category, name)
+	for _, c := range feeds {
+		for _, source := range c.Sources {
+			if SourceID(c.Category, source.Name) == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SaveFeedsToConfig replaces the feeds section of a config file. The rest
+// of the document, including comments, is kept as is.
+func SaveFeedsToConfig(path string, feeds []FeedCategory) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: top level is not a mapping", path)
+	}
+
+	var feedsNode yaml.Node
+	if err := feedsNode.Encode(feeds); err != nil {
+		return err
+	}
+
+	root := doc.Content[0]
+	replaced := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "feeds" {
+			root.Content[i+1] = &feedsNode
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "feeds"}, &feedsNode)
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	enc.Close()
+
+	// Write to a temporary file first so a crash cannot truncate the config
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// readConfigFeeds returns the feeds section of a single config file as
+// written, without fragments, expansion or overrides
+func readConfigFeeds(path string) ([]FeedCategory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	var file struct {
+		Feeds []FeedCategory `yaml:"feeds"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return file.Feeds, nil
+}
+
+// addedFeeds picks the sources listed in OPMLImportResult.Added out of merged
+func addedFeeds(merged []FeedCategory, added []string) []FeedCategory {
+	var out []FeedCategory
+	for _, category := range merged {
+		var sources []FeedSource
+		for _, source := range category.Sources {
+			if slices.Contains(added, fmt.Sprintf("%s:%s", category.Category, source.Name)) {
+				sources = append(sources, source)
+			}
+		}
+		if len(sources) > 0 {
+			out = append(out, FeedCategory{Category: category.Category, Color: category.Color, Sources: sources})
+		}
+	}
+	return out
+}
+
+// ImportOPML merges an OPML document into the running configuration,
+// persists it to ConfigPath and schedules the new sources for fetching
+func ImportOPML(r io.Reader) (OPMLImportResult, error) {
+	imported, err := ParseOPML(r)
+	if err != nil {
+		return OPMLImportResult{}, err
+	}
+
+	FeedCacheMu.Lock()
+	defer FeedCacheMu.Unlock()
+
+	merged, result := MergeFeeds(Cfg.Feeds, imported)
+	if len(result.Added) == 0 {
+		return result, nil
+	}
+
+	// Never write a config file the next start would reject
+	check := Cfg
+	check.Feeds = merged
+	if err := validateConfig(&check, &configSource{}); err != nil {
+		return result, fmt.Errorf("imported feeds are invalid: %w", err)
+	}
+
+	// Only the new sources are written, next to the feeds of the config file
+	// itself; feeds from config.d fragments and ${VAR} references stay as is
+	fileFeeds, err := readConfigFeeds(ConfigPath)
+	if err != nil {
+		return result, err
+	}
+	persisted, _ := MergeFeeds(fileFeeds, addedFeeds(merged, result.Added))
+	if err := SaveFeedsToConfig(ConfigPath, persisted); err != nil {
+		return result, err
+	}
+
+	Cfg.Feeds = merged
+	BumpCacheGeneration()
+	for _, category := range merged {
+		for _, source := range category.Sources {
+			cacheKey := fmt.Sprintf("%s:%s", category.Category, source.Name)
+			if _, ok := FeedCache[cacheKey]; ok {
+				continue
+			}
+			// The refresh worker picks these up on its next tick
+			FeedCache[cacheKey] = &FeedCacheEntry{
+				Items:       []*FeedItem{},
+				NextRefresh: time.Now(),
+				Interval:    time.Duration(Cfg.Refresh.IntervalMinutes) * time.Minute,
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// HandleOPMLExport returns the current subscriptions as OPML 2.0
+func HandleOPMLExport(w http.ResponseWriter, r *http.Request) {
+	FeedCacheMu.RLock()
+	out, err := ExportOPML(Cfg.Feeds)
+	FeedCacheMu.RUnlock()
+	if err != nil {
+		http.Error(w, "Failed to export OPML", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="dashboard.opml"`)
+	w.Write(out)
+}
+
+// HandleOPMLImport merges an uploaded OPML document into the subscriptions.
+// Importing rewrites the shared config, so wrap it with RequireAdmin.
+func HandleOPMLImport(w http.ResponseWriter, r *http.Request) {
+	result, err := ImportOPML(r.Body)
+	if err != nil {
+		log.Printf("OPML import failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("OPML import: %d added, %d duplicates, %d invalid", len(result.Added), len(result.Duplicates), len(result.Invalid))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeFeeds(t *testing.T) {
+	existing := []FeedCategory{{
+		Category: "News",
+		Color:    "#123456",
+		Sources:  []FeedSource{{Name: "Foo Bar", URL: "https://foo.example/rss"}},
+	}}
+	imported := []FeedCategory{
+		{Category: "news", Sources: []FeedSource{
+			// Same source ID as "Foo Bar"
+			{Name: "foo-bar", URL: "https://other.example/rss"},
+			// Same URL once normalized
+			{Name: "Foo again", URL: "http://www.foo.example/rss/"},
+			// Relative URLs cannot be fetched
+			{Name: "Relative", URL: "feed.xml"},
+		}},
+		{Category: "Tech", Sources: []FeedSource{{Name: "Go", URL: "https://go.dev/blog/feed.atom"}}},
+	}
+
+	merged, result := MergeFeeds(existing, imported)
+
+	if want := []string{"News:foo-bar (2)", "Tech:Go"}; !slices.Equal(result.Added, want) {
+		t.Errorf("Added = %q, want %q", result.Added, want)
+	}
+	if want := []string{"http://www.foo.example/rss/"}; !slices.Equal(result.Duplicates, want) {
+		t.Errorf("Duplicates = %q, want %q", result.Duplicates, want)
+	}
+	if want := []string{"feed.xml"}; !slices.Equal(result.Invalid, want) {
+		t.Errorf("Invalid = %q, want %q", result.Invalid, want)
+	}
+	if want := []string{"Tech"}; !slices.Equal(result.Categories, want) {
+		t.Errorf("Categories = %q, want %q", result.Categories, want)
+	}
+	if len(existing[0].Sources) != 1 {
+		t.Errorf("existing feeds were modified: %v", existing[0].Sources)
+	}
+
+	cfg := Config{Feeds: merged}
+	applyConfigDefaults(&cfg)
+	if err := validateConfig(&cfg, &configSource{}); err != nil {
+		t.Errorf("merged feeds do not validate: %v", err)
+	}
+}
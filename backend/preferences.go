@@ -0,0 +1,502 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// preferencesFormatVersion is the version of the exported preferences
+// document. Version 1 had no settings; it is still accepted on import.
+const preferencesFormatVersion = 2
+
+// Import modes: replace drops the existing weights and clicks of every user
+// in the document first; merge keeps them, overwrites tokens that are in the
+// document and skips clicks that are already stored.
+const (
+	ImportReplace = "replace"
+	ImportMerge   = "merge"
+)
+
+// ExportedTokenWeight is a learned token weight in a preferences export
+type ExportedTokenWeight struct {
+	UserID    string    `json:"userId"`
+	Token     string    `json:"token"`
+	Weight    float64   `json:"weight"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ExportedClickEvent is a recorded click in a preferences export
+type ExportedClickEvent struct {
+	UserID    string    `json:"userId"`
+	ItemKey   string    `json:"itemKey"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	Source    string    `json:"source"`
+	Category  string    `json:"category"`
+	ClickedAt time.Time `json:"clickedAt"`
+}
+
+// MLSettings are the model settings the weights were learned with
+type MLSettings struct {
+	MaxItemAgeHours  int     `json:"maxItemAgeHours"`
+	ClickWeight      float64 `json:"clickWeight"`
+	TokenDecayPerDay float64 `json:"tokenDecayPerDay"`
+	RetentionDays    int     `json:"retentionDays"`
+}
+
+// PreferencesExport is the portable JSON form of the learned preferences
+type PreferencesExport struct {
+	Version      int                   `json:"version"`
+	ExportedAt   time.Time             `json:"exportedAt"`
+	Settings     *MLSettings           `json:"settings,omitempty"`
+	TokenWeights []ExportedTokenWeight `json:"tokenWeights"`
+	ClickEvents  []ExportedClickEvent  `json:"clickEvents"`
+}
+
+// preferencesHeader is the first line of the NDJSON form. Every following
+// line is a tokenWeight or clickEvent record.
+type preferencesHeader struct {
+	Type       string      `json:"type"`
+	Version    int         `json:"version"`
+	ExportedAt time.Time   `json:"exportedAt"`
+	Settings   *MLSettings `json:"settings,omitempty"`
+}
+
+// ImportOptions control how ImportPreferences applies a document
+type ImportOptions struct {
+	// ImportReplace (default) or ImportMerge
+	Mode string
+	// Import a single-user document into this user instead
+	AsUser string
+	// Create (non-admin) profiles for users that do not exist yet instead of
+	// rejecting the document
+	CreateUsers bool
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Users              []string `json:"users"`
+	CreatedUsers       []string `json:"createdUsers,omitempty"`
+	TokenWeights       int      `json:"tokenWeights"`
+	ClickEvents        int      `json:"clickEvents"`
+	SkippedClickEvents int      `json:"skippedClickEvents"`
+	// Settings of the exporting instance that differ from this one's
+	SettingsDiffer []string `json:"settingsDiffer,omitempty"`
+}
+
+func currentMLSettings() MLSettings {
+	return MLSettings{
+		MaxItemAgeHours:  Cfg.ML.MaxItemAgeHours,
+		ClickWeight:      Cfg.ML.ClickWeight,
+		TokenDecayPerDay: Cfg.ML.TokenDecayPerDay,
+		RetentionDays:    Cfg.ML.RetentionDays,
+	}
+}
+
+// readPreferences loads the token weights and click history of a user ("" for
+// all users)
+func readPreferences(userID string) (PreferencesExport, error) {
+	where, args := userFilter(userID)
+	settings := currentMLSettings()
+	doc := PreferencesExport{
+		Version:      preferencesFormatVersion,
+		ExportedAt:   time.Now().UTC(),
+		Settings:     &settings,
+		TokenWeights: []ExportedTokenWeight{},
+		ClickEvents:  []ExportedClickEvent{},
+	}
+
+	rows, err := db.Query("SELECT user_id, token, weight, updated_at FROM token_weights"+where+" ORDER BY user_id, token", args...)
+	if err != nil {
+		return doc, fmt.Errorf("failed to read token weights: %w", err)
+	}
+	for rows.Next() {
+		var tw ExportedTokenWeight
+		if err := rows.Scan(&tw.UserID, &tw.Token, &tw.Weight, &tw.UpdatedAt); err != nil {
+			rows.Close()
+			return doc, fmt.Errorf("failed to scan token weight: %w", err)
+		}
+		doc.TokenWeights = append(doc.TokenWeights, tw)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return doc, err
+	}
+
+	rows, err = db.Query("SELECT user_id, item_key, title, link, source, category, clicked_at FROM click_events"+where+" ORDER BY clicked_at, id", args...)
+	if err != nil {
+		return doc, fmt.Errorf("failed to read click events: %w", err)
+	}
+	for rows.Next() {
+		var ev ExportedClickEvent
+		if err := rows.Scan(&ev.UserID, &ev.ItemKey, &ev.Title, &ev.Link, &ev.Source, &ev.Category, &ev.ClickedAt); err != nil {
+			rows.Close()
+			return doc, fmt.Errorf("failed to scan click event: %w", err)
+		}
+		doc.ClickEvents = append(doc.ClickEvents, ev)
+	}
+	rows.Close()
+	return doc, rows.Err()
+}
+
+// writePreferences writes doc as one indented JSON document, or as NDJSON
+// (a header line followed by one record per line) for streaming tools
+func writePreferences(w io.Writer, doc PreferencesExport, ndjson bool) error {
+	enc := json.NewEncoder(w)
+	if !ndjson {
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+
+	if err := enc.Encode(preferencesHeader{Type: "header", Version: doc.Version, ExportedAt: doc.ExportedAt, Settings: doc.Settings}); err != nil {
+		return err
+	}
+	for _, tw := range doc.TokenWeights {
+		record := struct {
+			Type string `json:"type"`
+			ExportedTokenWeight
+		}{"tokenWeight", tw}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	for _, ev := range doc.ClickEvents {
+		record := struct {
+			Type string `json:"type"`
+			ExportedClickEvent
+		}{"clickEvent", ev}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportPreferences writes the token weights, click history and model
+// settings of a user ("" for all users) as JSON or NDJSON
+func ExportPreferences(w io.Writer, userID string, ndjson bool) error {
+	doc, err := readPreferences(userID)
+	if err != nil {
+		return err
+	}
+	return writePreferences(w, doc, ndjson)
+}
+
+// decodePreferences reads either form written by writePreferences
+func decodePreferences(r io.Reader) (PreferencesExport, error) {
+	var doc PreferencesExport
+	dec := json.NewDecoder(r)
+
+	var first json.RawMessage
+	if err := dec.Decode(&first); err != nil {
+		return doc, fmt.Errorf("invalid preferences document: %w", err)
+	}
+	var record struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(first, &record); err != nil {
+		return doc, fmt.Errorf("invalid preferences document: %w", err)
+	}
+
+	switch record.Type {
+	case "":
+		if err := json.Unmarshal(first, &doc); err != nil {
+			return doc, fmt.Errorf("invalid preferences document: %w", err)
+		}
+	case "header":
+		var header preferencesHeader
+		if err := json.Unmarshal(first, &header); err != nil {
+			return doc, fmt.Errorf("invalid preferences header: %w", err)
+		}
+		doc.Version, doc.ExportedAt, doc.Settings = header.Version, header.ExportedAt, header.Settings
+
+		for line := 2; ; line++ {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err == io.EOF {
+				break
+			} else if err != nil {
+				return doc, fmt.Errorf("invalid preferences record %d: %w", line, err)
+			}
+			record.Type = ""
+			err := json.Unmarshal(raw, &record)
+			if err != nil {
+				return doc, fmt.Errorf("invalid preferences record %d: %w", line, err)
+			}
+			switch record.Type {
+			case "tokenWeight":
+				var tw ExportedTokenWeight
+				err = json.Unmarshal(raw, &tw)
+				doc.TokenWeights = append(doc.TokenWeights, tw)
+			case "clickEvent":
+				var ev ExportedClickEvent
+				err = json.Unmarshal(raw, &ev)
+				doc.ClickEvents = append(doc.ClickEvents, ev)
+			default:
+				err = fmt.Errorf("unknown type %q", record.Type)
+			}
+			if err != nil {
+				return doc, fmt.Errorf("invalid preferences record %d: %w", line, err)
+			}
+		}
+	default:
+		return doc, fmt.Errorf("invalid preferences document: expected a header record first, got %q", record.Type)
+	}
+
+	if doc.Version < 1 || doc.Version > preferencesFormatVersion {
+		return doc, fmt.Errorf("unsupported preferences format version %d (expected 1 to %d)", doc.Version, preferencesFormatVersion)
+	}
+	return doc, nil
+}
+
+// settingsDiffer lists the settings in which an exporting instance differs
+// from this one. Weights learned with another clickWeight or decay score
+// differently here, but the config file stays authoritative.
+func settingsDiffer(imported *MLSettings) []string {
+	if imported == nil {
+		return nil
+	}
+	current := currentMLSettings()
+	var differ []string
+	if imported.MaxItemAgeHours != current.MaxItemAgeHours {
+		differ = append(differ, fmt.Sprintf("maxItemAgeHours %d (here %d)", imported.MaxItemAgeHours, current.MaxItemAgeHours))
+	}
+	if imported.ClickWeight != current.ClickWeight {
+		differ = append(differ, fmt.Sprintf("clickWeight %g (here %g)", imported.ClickWeight, current.ClickWeight))
+	}
+	if imported.TokenDecayPerDay != current.TokenDecayPerDay {
+		differ = append(differ, fmt.Sprintf("tokenDecayPerDay %g (here %g)", imported.TokenDecayPerDay, current.TokenDecayPerDay))
+	}
+	if imported.RetentionDays != current.RetentionDays {
+		differ = append(differ, fmt.Sprintf("retentionDays %d (here %d)", imported.RetentionDays, current.RetentionDays))
+	}
+	return differ
+}
+
+// ImportPreferences reads an ExportPreferences document (JSON or NDJSON) and
+// applies it to the users it contains. Other users are untouched.
+func ImportPreferences(r io.Reader, opts ImportOptions) (ImportResult, error) {
+	var result ImportResult
+	switch opts.Mode {
+	case "":
+		opts.Mode = ImportReplace
+	case ImportReplace, ImportMerge:
+	default:
+		return result, fmt.Errorf("invalid import mode %q (expected %s or %s)", opts.Mode, ImportReplace, ImportMerge)
+	}
+
+	doc, err := decodePreferences(r)
+	if err != nil {
+		return result, err
+	}
+
+	users := map[string]bool{}
+	for _, tw := range doc.TokenWeights {
+		users[tw.UserID] = true
+	}
+	for _, ev := range doc.ClickEvents {
+		users[ev.UserID] = true
+	}
+	if users[""] {
+		return result, errors.New("invalid preferences document: entry without userId")
+	}
+
+	if opts.AsUser != "" {
+		if len(users) > 1 {
+			return result, fmt.Errorf("the document contains %d users; export a single user to import it as %q", len(users), opts.AsUser)
+		}
+		for i := range doc.TokenWeights {
+			doc.TokenWeights[i].UserID = opts.AsUser
+		}
+		for i := range doc.ClickEvents {
+			doc.ClickEvents[i].UserID = opts.AsUser
+		}
+		users = map[string]bool{opts.AsUser: true}
+	}
+	for userID := range users {
+		result.Users = append(result.Users, userID)
+	}
+	sort.Strings(result.Users)
+
+	var missing []string
+	for _, userID := range result.Users {
+		if !userIDPattern.MatchString(userID) {
+			return result, fmt.Errorf("invalid user ID %q", userID)
+		}
+		if _, exists := LookupUser(userID); !exists && userID != DefaultUserID {
+			missing = append(missing, userID)
+		}
+	}
+	if len(missing) > 0 && !opts.CreateUsers {
+		return result, fmt.Errorf("unknown users %q; create them first or allow creating them", missing)
+	}
+	for _, userID := range missing {
+		if _, err := CreateUser(userID, false); err != nil {
+			return result, err
+		}
+		result.CreatedUsers = append(result.CreatedUsers, userID)
+	}
+	result.SettingsDiffer = settingsDiffer(doc.Settings)
+
+	// Keep clicks from updating weights while they are being replaced
+	TokenWeightMu.Lock()
+	err = importPreferences(doc, result.Users, opts.Mode, &result)
+	TokenWeightMu.Unlock()
+	if err != nil {
+		return result, err
+	}
+	return result, LoadTokenWeights()
+}
+
+func importPreferences(doc PreferencesExport, users []string, mode string, result *ImportResult) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Clicks already stored, by user, item and time, so merging the same
+	// document twice does not duplicate them
+	existing := map[string]bool{}
+	clickKey := func(userID, itemKey string, clickedAt time.Time) string {
+		return fmt.Sprintf("%s\x00%s\x00%d", userID, itemKey, clickedAt.UnixNano())
+	}
+
+	for _, userID := range users {
+		if mode == ImportReplace {
+			if _, err := tx.Exec("DELETE FROM token_weights WHERE user_id = ?", userID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("DELETE FROM click_events WHERE user_id = ?", userID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rows, err := tx.Query("SELECT item_key, clicked_at FROM click_events WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to read click events: %w", err)
+		}
+		for rows.Next() {
+			var itemKey string
+			var clickedAt time.Time
+			if err := rows.Scan(&itemKey, &clickedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan click event: %w", err)
+			}
+			existing[clickKey(userID, itemKey, clickedAt)] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, tw := range doc.TokenWeights {
+		if _, err := tx.Exec(
+			`INSERT INTO token_weights (user_id, token, weight, updated_at) VALUES (?, ?, ?, ?)
+			 ON CONFLICT(user_id, token) DO UPDATE SET weight = excluded.weight, updated_at = excluded.updated_at`,
+			tw.UserID, tw.Token, tw.Weight, tw.UpdatedAt,
+		); err != nil {
+			return fmt.Errorf("failed to import token weight %q: %w", tw.Token, err)
+		}
+		result.TokenWeights++
+	}
+	for _, ev := range doc.ClickEvents {
+		key := clickKey(ev.UserID, ev.ItemKey, ev.ClickedAt)
+		if existing[key] {
+			result.SkippedClickEvents++
+			continue
+		}
+		existing[key] = true
+		if _, err := tx.Exec(
+			`INSERT INTO click_events (user_id, item_key, title, link, source, category, clicked_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			ev.UserID, ev.ItemKey, ev.Title, ev.Link, ev.Source, ev.Category, ev.ClickedAt,
+		); err != nil {
+			return fmt.Errorf("failed to import click event: %w", err)
+		}
+		result.ClickEvents++
+	}
+	return tx.Commit()
+}
+
+// HandleMLExport returns the learned preferences as a download
+// (?format=json|ndjson). Admins may pass ?user= or export all users; other
+// users get their own profile.
+func HandleMLExport(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := AuthenticatedUser(r.Context())
+	if !authenticated {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target := r.URL.Query().Get("user")
+	if !IsAdmin(userID) {
+		if target != "" && target != userID {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		target = userID
+	}
+
+	var ndjson bool
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+	case "ndjson":
+		ndjson = true
+	default:
+		http.Error(w, "Unsupported format (expected json or ndjson)", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := readPreferences(target)
+	if err != nil {
+		log.Printf("Preferences export failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	name, contentType := "preferences", "application/json"
+	if target != "" {
+		name += "-" + target
+	}
+	if ndjson {
+		name, contentType = name+".ndjson", "application/x-ndjson"
+	} else {
+		name += ".json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "no-store")
+	if err := writePreferences(w, doc, ndjson); err != nil {
+		log.Printf("Preferences export failed: %v", err)
+	}
+}
+
+// HandleMLImport applies an uploaded preferences document
+// (?mode=replace|merge, optional ?as=<user ID> and ?createUsers=true)
+func HandleMLImport(w http.ResponseWriter, r *http.Request) {
+	result, err := ImportPreferences(r.Body, ImportOptions{
+		Mode:        r.URL.Query().Get("mode"),
+		AsUser:      r.URL.Query().Get("as"),
+		CreateUsers: r.URL.Query().Get("createUsers") == "true",
+	})
+	if err != nil {
+		log.Printf("Preferences import failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, userID := range result.CreatedUsers {
+		log.Printf("Created user %q for preferences import", userID)
+	}
+	log.Printf("Preferences import for %v: %d token weights, %d click events (%d skipped)",
+		result.Users, result.TokenWeights, result.ClickEvents, result.SkippedClickEvents)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
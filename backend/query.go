@@ -0,0 +1,186 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTopN caps the topN query parameter of /api/dashboard
+const maxTopN = 200
+
+// itemFields maps the JSON names accepted by fields= to FeedItem values
+var itemFields = map[string]func(FeedItem) any{
+	"title":       func(i FeedItem) any { return i.Title },
+	"link":        func(i FeedItem) any { return i.Link },
+	"publishedAt": func(i FeedItem) any { return i.PublishedAt },
+	"source":      func(i FeedItem) any { return i.Source },
+	"category":    func(i FeedItem) any { return i.Category },
+	"description": func(i FeedItem) any { return i.Description },
+	"author":      func(i FeedItem) any { return i.Author },
+	"guid":        func(i FeedItem) any { return i.GUID },
+	"score":       func(i FeedItem) any { return i.Score },
+	"age":         func(i FeedItem) any { return i.Age },
+}
+
+// DashboardQuery holds the optional /api/dashboard query parameters:
+//
+//	category=tech,dev  only these categories
+//	source=HN          only these sources
+//	limit=10           at most this many items per source
+//	since=<RFC 3339 or unix seconds>  only items published after this time
+//	fields=title,link  only these item fields (e.g. to drop descriptions)
+//	topN=5             size of the top-rated list (default topRatedDashboardLimit)
+type DashboardQuery struct {
+	Categories []string
+	Sources    []string
+	Limit      int
+	Since      time.Time
+	Fields     []string
+	TopN       int
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// ParseDashboardQuery validates the query parameters of a dashboard request
+func ParseDashboardQuery(values url.Values) (DashboardQuery, error) {
+	q := DashboardQuery{
+		Categories: splitList(values.Get("category")),
+		Sources:    splitList(values.Get("source")),
+		Fields:     splitList(values.Get("fields")),
+		TopN:       topRatedDashboardLimit,
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return q, fmt.Errorf("invalid limit %q", raw)
+		}
+		q.Limit = limit
+	}
+
+	if raw := values.Get("since"); raw != "" {
+		if secs, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			q.Since = time.Unix(secs, 0)
+		} else if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			q.Since = t
+		} else {
+			return q, fmt.Errorf("invalid since %q (expected RFC 3339 or unix seconds)", raw)
+		}
+	}
+
+	if raw := values.Get("topN"); raw != "" {
+		topN, err := strconv.Atoi(raw)
+		if err != nil || topN < 0 {
+			return q, fmt.Errorf("invalid topN %q", raw)
+		}
+		q.TopN = min(topN, maxTopN)
+	}
+
+	for _, field := range q.Fields {
+		if _, ok := itemFields[field]; !ok {
+			return q, fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	return q, nil
+}
+
+// IsDefault reports whether the query asks for the full, cacheable response
+func (q DashboardQuery) IsDefault() bool {
+	return len(q.Categories) == 0 && len(q.Sources) == 0 && q.Limit == 0 &&
+		q.Since.IsZero() && len(q.Fields) == 0 && q.TopN == topRatedDashboardLimit
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterGroups applies category, source, since and limit to feed groups
+func (q DashboardQuery) filterGroups(groups []FeedGroup) []FeedGroup {
+	result := []FeedGroup{}
+	for _, group := range groups {
+		if len(q.Categories) > 0 && !containsFold(q.Categories, group.Category) {
+			continue
+		}
+		if len(q.Sources) > 0 && !containsFold(q.Sources, group.Source) {
+			continue
+		}
+
+		// Items are sorted newest first, so since and limit both cut a prefix
+		items := group.Items
+		if !q.Since.IsZero() {
+			n := 0
+			for n < len(items) && items[n].PublishedAt.After(q.Since) {
+				n++
+			}
+			items = items[:n]
+		}
+		if q.Limit > 0 && len(items) > q.Limit {
+			items = items[:q.Limit]
+		}
+		group.Items = items
+
+		result = append(result, group)
+	}
+	return result
+}
+
+// shapedFeedGroup replaces the items of a group with field projections
+type shapedFeedGroup struct {
+	FeedGroup
+	Items []map[string]any `json:"items"`
+}
+
+type shapedAPIResponse struct {
+	Feeds    []shapedFeedGroup `json:"feeds"`
+	TopRated []TopRatedItem    `json:"topRated"`
+	Version  string            `json:"version,omitempty"`
+}
+
+// shapedDashboardResponse serializes the dashboard for a non-default query.
+// These responses are not cached; the ETag still allows 304 replies.
+func shapedDashboardResponse(userID string, q DashboardQuery) ([]byte, string, error) {
+	groups := q.filterGroups(GetAllFeeds())
+	topRated := GetTopRatedItems(userID, q.TopN)
+
+	var response any = APIResponse{Feeds: groups, TopRated: topRated, Version: AppVersion}
+	if len(q.Fields) > 0 {
+		shaped := shapedAPIResponse{Feeds: make([]shapedFeedGroup, 0, len(groups)), TopRated: topRated, Version: AppVersion}
+		for _, group := range groups {
+			sg := shapedFeedGroup{FeedGroup: group, Items: make([]map[string]any, 0, len(group.Items))}
+			for _, item := range group.Items {
+				projected := make(map[string]any, len(q.Fields))
+				for _, field := range q.Fields {
+					projected[field] = itemFields[field](item)
+				}
+				sg.Items = append(sg.Items, projected)
+			}
+			shaped.Feeds = append(shaped.Feeds, sg)
+		}
+		response = shaped
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(response); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), contentETag(buf.Bytes()), nil
+}
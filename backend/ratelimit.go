@@ -1,94 +1,316 @@
 package backend
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-// RateLimiter tracks requests per IP
+// RateLimiter is a token-bucket limiter with O(1) state per client key.
+// Each bucket refills continuously at ratePerMinute/60 tokens per second up
+// to burst tokens; a request consumes one token.
 type RateLimiter struct {
-	mu      sync.RWMutex
-	clients map[string]*ClientRateLimit
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
 }
 
-// ClientRateLimit tracks rate limit info for a single IP
-type ClientRateLimit struct {
-	requests  []time.Time
-	lastCheck time.Time
+type tokenBucket struct {
+	tokens  float64
+	last    time.Time
+	fullAge time.Duration // time after which the bucket is full again and can be evicted
 }
 
-var rateLimiter = &RateLimiter{
-	clients: make(map[string]*ClientRateLimit),
+// RateLimitResult describes the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // until the next token, when not allowed
+	Reset      time.Duration // until the bucket is full again
 }
 
-// GetClientIP extracts client IP from request
-func GetClientIP(r *http.Request) string {
-	// Check X-Forwarded-For first (proxy/reverse proxy)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
+// rateLimiters lists every limiter so one janitor can evict idle buckets
+var (
+	rateLimiters   []*RateLimiter
+	rateLimitersMu sync.Mutex
+)
+
+// NewRateLimiter creates an empty limiter and registers it with the janitor
+func NewRateLimiter() *RateLimiter {
+	rl := &RateLimiter{buckets: make(map[string]*tokenBucket)}
+	rateLimitersMu.Lock()
+	rateLimiters = append(rateLimiters, rl)
+	rateLimitersMu.Unlock()
+	return rl
+}
+
+// trustedProxies holds the parsed server.trustedProxies CIDRs and
+// forwardedHeader the one header (server.forwardedHeader) they set
+var (
+	trustedProxies   []netip.Prefix
+	forwardedHeader  = "X-Forwarded-For"
+	trustedProxiesMu sync.RWMutex
+)
+
+// SetTrustedProxies parses the CIDRs (or bare IPs) of reverse proxies whose
+// forwarding header may be believed, and the name of that header
+func SetTrustedProxies(cidrs []string, header string) error {
+	prefixes, err := parseTrustedProxies(cidrs)
+	if err != nil {
+		return err
 	}
-	// Check X-Real-IP
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	name, err := parseForwardedHeader(header)
+	if err != nil {
+		return err
 	}
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
+
+	trustedProxiesMu.Lock()
+	trustedProxies = prefixes
+	forwardedHeader = name
+	trustedProxiesMu.Unlock()
+	return nil
 }
 
-// IsAllowed checks if IP is within rate limit
-// Returns true if request is allowed, false if rate limited
-func (rl *RateLimiter) IsAllowed(ip string, requestsPerMinute int) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// parseForwardedHeader returns the canonical name of server.forwardedHeader
+func parseForwardedHeader(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "xff", "x-forwarded-for":
+		return "X-Forwarded-For", nil
+	case "forwarded":
+		return "Forwarded", nil
+	case "x-real-ip":
+		return "X-Real-IP", nil
+	}
+	return "", fmt.Errorf("unsupported forwarded header %q (expected X-Forwarded-For, Forwarded or X-Real-IP)", name)
+}
 
-	now := time.Now()
-	client, exists := rl.clients[ip]
-
-	// Clean up old entries (older than 2 minutes)
-	if exists {
-		cutoff := now.Add(-2 * time.Minute)
-		validRequests := []time.Time{}
-		for _, req := range client.requests {
-			if req.After(cutoff) {
-				validRequests = append(validRequests, req)
+func parseTrustedProxies(cidrs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if !strings.Contains(c, "/") {
+			addr, err := netip.ParseAddr(c)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", c, err)
 			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", c, err)
 		}
-		client.requests = validRequests
+		prefixes = append(prefixes, prefix.Masked())
 	}
 
-	// Create new entry if doesn't exist
-	if !exists {
-		rl.clients[ip] = &ClientRateLimit{
-			requests:  []time.Time{now},
-			lastCheck: now,
+	return prefixes, nil
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	trustedProxiesMu.RLock()
+	defer trustedProxiesMu.RUnlock()
+
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
 		}
-		return true
 	}
+	return false
+}
 
-	// Check if within limit
-	if len(client.requests) < requestsPerMinute {
-		client.requests = append(client.requests, now)
+// fromTrustedProxy reports whether the direct peer is a trusted proxy. Peers
+// on the Unix socket (server.socket) are always local proxies.
+func fromTrustedProxy(r *http.Request) bool {
+	if fromUnixSocket(r) {
 		return true
 	}
+	remote, ok := parseHostAddr(r.RemoteAddr)
+	return ok && isTrustedProxy(remote)
+}
 
-	return false
+// parseHostAddr parses an IP with an optional port, brackets or IPv6 zone
+func parseHostAddr(s string) (netip.Addr, bool) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
 }
 
-// RateLimitMiddleware enforces per-IP rate limiting
-// Use with: rateLimitedHandler := RateLimitMiddleware(myHandler, 60) // 60 req/min
-func RateLimitMiddleware(handler http.Handler, requestsPerMinute int) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		clientIP := GetClientIP(r)
+// forwardedFor returns the client addresses from server.forwardedHeader, in
+// hop order. Other forwarding headers are ignored: a proxy that writes one
+// header usually passes the others through from the client unchanged.
+func forwardedFor(r *http.Request) []string {
+	trustedProxiesMu.RLock()
+	header := forwardedHeader
+	trustedProxiesMu.RUnlock()
 
-		if !rateLimiter.IsAllowed(clientIP, requestsPerMinute) {
-			w.Header().Set("Retry-After", "60")
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+	var hops []string
+	for _, value := range r.Header.Values(header) {
+		switch header {
+		case "Forwarded":
+			// RFC 7239: comma-separated elements of ;-separated pairs
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					name, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(name, "for") {
+						hops = append(hops, val)
+					}
+				}
+			}
+		case "X-Real-IP":
+			hops = append(hops, strings.TrimSpace(value))
+		default:
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+	return hops
+}
+
+// GetClientIP extracts client IP from request. The forwarding header is only
+// used when the direct peer is a trusted proxy; it is then walked right to
+// left and the first address that is not itself a trusted proxy is the client.
+func GetClientIP(r *http.Request) string {
+	remote, ok := parseHostAddr(r.RemoteAddr)
+	if !fromTrustedProxy(r) {
+		if !ok {
+			// Non-IP addresses
+			return r.RemoteAddr
+		}
+		return remote.String()
+	}
+
+	hops := forwardedFor(r)
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHostAddr(hops[i])
+		if !ok {
+			// Obfuscated identifiers ("unknown", "_hidden") end the trusted chain
+			break
+		}
+		if !isTrustedProxy(addr) {
+			return addr.String()
+		}
+	}
+
+	if !ok {
+		// Unix socket peer without forwarding headers
+		return r.RemoteAddr
+	}
+	return remote.String()
+}
+
+// rateLimitKey buckets IPv6 clients by /64 since a single host usually
+// controls a whole prefix
+func rateLimitKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is6() {
+		return ip
+	}
+	prefix, err := addr.Prefix(64)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// Allow takes a token from the key's bucket if one is available. A rate of
+// zero or less means unlimited and keeps no state.
+func (rl *RateLimiter) Allow(key string, ratePerMinute, burst int) RateLimitResult {
+	if ratePerMinute <= 0 {
+		return RateLimitResult{Allowed: true}
+	}
+	if burst <= 0 {
+		burst = ratePerMinute
+	}
+	perSecond := float64(ratePerMinute) / 60
+	fullAge := time.Duration(float64(burst) / perSecond * float64(time.Second))
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(burst), last: now}
+		rl.buckets[key] = bucket
+	}
+
+	// Refill for the time elapsed since the last request
+	bucket.tokens += now.Sub(bucket.last).Seconds() * perSecond
+	if bucket.tokens > float64(burst) {
+		bucket.tokens = float64(burst)
+	}
+	bucket.last = now
+	bucket.fullAge = fullAge
+
+	result := RateLimitResult{Limit: ratePerMinute}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+	}
+	result.Remaining = int(bucket.tokens)
+	result.Reset = time.Duration((float64(burst) - bucket.tokens) / perSecond * float64(time.Second))
+	return result
+}
+
+// evictIdle removes buckets that have refilled completely, which behave
+// exactly like a missing bucket
+func (rl *RateLimiter) evictIdle(now time.Time) int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	evicted := 0
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.last) >= bucket.fullAge {
+			delete(rl.buckets, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// RateLimitJanitor periodically evicts idle buckets from all limiters so
+// memory stays proportional to the number of recently active clients
+func RateLimitJanitor(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case now := <-ticker.C:
+			rateLimitersMu.Lock()
+			limiters := append([]*RateLimiter{}, rateLimiters...)
+			rateLimitersMu.Unlock()
+
+			for _, rl := range limiters {
+				rl.evictIdle(now)
+			}
 		}
+	}
+}
 
-		handler.ServeHTTP(w, r)
-	})
+func setRateLimitHeaders(w http.ResponseWriter, result RateLimitResult) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
 }
 
 // MaxBodySizeMiddleware enforces maximum request body size
@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string // server.forwardedHeader
+		remote  string
+		unix    bool
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:    "untrusted peer ignores headers",
+			remote:  "198.51.100.7:4000",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.9"},
+			want:    "198.51.100.7",
+		},
+		{
+			name:    "trusted peer uses X-Forwarded-For",
+			remote:  "127.0.0.1:4000",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.9"},
+			want:    "203.0.113.9",
+		},
+		{
+			name:    "client-supplied hops left of the proxy are ignored",
+			remote:  "127.0.0.1:4000",
+			headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 203.0.113.9"},
+			want:    "203.0.113.9",
+		},
+		{
+			name:   "client-supplied Forwarded is ignored with X-Forwarded-For",
+			remote: "127.0.0.1:4000",
+			headers: map[string]string{
+				"Forwarded":       "for=6.6.6.6",
+				"X-Forwarded-For": "203.0.113.9",
+			},
+			want: "203.0.113.9",
+		},
+		{
+			name:    "client-supplied X-Real-IP is ignored with X-Forwarded-For",
+			remote:  "127.0.0.1:4000",
+			headers: map[string]string{"X-Real-IP": "6.6.6.6"},
+			want:    "127.0.0.1",
+		},
+		{
+			name:   "Forwarded when configured",
+			header: "forwarded",
+			remote: "127.0.0.1:4000",
+			headers: map[string]string{
+				"Forwarded":       `for="[2001:db8::1]:1234";proto=https`,
+				"X-Forwarded-For": "6.6.6.6",
+			},
+			want: "2001:db8::1",
+		},
+		{
+			name:    "obfuscated Forwarded identifier ends the chain",
+			header:  "Forwarded",
+			remote:  "127.0.0.1:4000",
+			headers: map[string]string{"Forwarded": "for=unknown"},
+			want:    "127.0.0.1",
+		},
+		{
+			name:   "X-Real-IP when configured",
+			header: "X-Real-IP",
+			remote: "127.0.0.1:4000",
+			headers: map[string]string{
+				"X-Real-IP":       "203.0.113.9",
+				"X-Forwarded-For": "6.6.6.6",
+			},
+			want: "203.0.113.9",
+		},
+		{
+			name:    "Unix socket peer is trusted",
+			remote:  "@",
+			unix:    true,
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.9"},
+			want:    "203.0.113.9",
+		},
+		{
+			name:   "Unix socket peer without header",
+			remote: "@",
+			unix:   true,
+			want:   "@",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetTrustedProxies([]string{"127.0.0.1", "::1/128"}, tt.header); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { SetTrustedProxies(nil, "") })
+
+			r := httptest.NewRequest("GET", "/api/dashboard", nil)
+			r.RemoteAddr = tt.remote
+			if tt.unix {
+				r = r.WithContext(context.WithValue(r.Context(), unixSocketKey{}, true))
+			}
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			if got := GetClientIP(r); got != tt.want {
+				t.Errorf("GetClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseForwardedHeader(t *testing.T) {
+	for input, want := range map[string]string{
+		"":                "X-Forwarded-For",
+		"xff":             "X-Forwarded-For",
+		"x-forwarded-for": "X-Forwarded-For",
+		"Forwarded":       "Forwarded",
+		"X-REAL-IP":       "X-Real-IP",
+	} {
+		if got, err := parseForwardedHeader(input); err != nil || got != want {
+			t.Errorf("parseForwardedHeader(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := parseForwardedHeader("True-Client-IP"); err == nil {
+		t.Error("parseForwardedHeader accepted an unsupported header")
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	rl := &RateLimiter{buckets: map[string]*tokenBucket{}}
+
+	for i := 0; i < 3; i++ {
+		if result := rl.Allow("client", 60, 3); !result.Allowed {
+			t.Fatalf("request %d within the burst was rejected", i+1)
+		}
+	}
+	result := rl.Allow("client", 60, 3)
+	if result.Allowed {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Errorf("RetryAfter = %v, want up to 1s at 60/min", result.RetryAfter)
+	}
+	if other := rl.Allow("other", 60, 3); !other.Allowed {
+		t.Error("buckets are not independent per key")
+	}
+
+	for _, rate := range []int{0, -1} {
+		result := rl.Allow("unlimited", rate, 0)
+		if !result.Allowed || result.RetryAfter != 0 || result.Reset != 0 {
+			t.Errorf("Allow with rate %d = %+v, want an unlimited result", rate, result)
+		}
+	}
+	if _, ok := rl.buckets["unlimited"]; ok {
+		t.Error("unlimited requests created a bucket")
+	}
+}
@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// basePath is the URL prefix the dashboard is served under ("" for the root).
+// It is set once at startup from server.basePath.
+var basePath string
+
+// unixSocketKey marks requests that arrived on the Unix socket listener
+type unixSocketKey struct{}
+
+// normalizeBasePath validates server.basePath ("/dashboard/" and
+// "/dashboard" are equivalent)
+func normalizeBasePath(raw string) (string, error) {
+	p := strings.TrimSuffix(strings.TrimSpace(raw), "/")
+	if p != "" && (!strings.HasPrefix(p, "/") || strings.ContainsAny(p, "?#") || path.Clean(p) != p) {
+		return "", fmt.Errorf("invalid path %q (expected e.g. /dashboard)", raw)
+	}
+	return p, nil
+}
+
+// SetBasePath sets the URL prefix from server.basePath
+func SetBasePath(raw string) error {
+	p, err := normalizeBasePath(raw)
+	if err != nil {
+		return err
+	}
+	basePath = p
+	return nil
+}
+
+// BasePathMiddleware strips server.basePath from request paths, so handlers
+// and route patterns stay the same wherever the dashboard is mounted
+func BasePathMiddleware(next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+	stripped := http.StripPrefix(basePath, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == basePath:
+			target := basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, basePath+"/"):
+			stripped.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func fromUnixSocket(r *http.Request) bool {
+	unix, _ := r.Context().Value(unixSocketKey{}).(bool)
+	return unix
+}
+
+func secondsOr(seconds int, def time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return def
+}
+
+// NewHTTPServer returns a server with the configured timeouts and header
+// limit. The defaults keep slow clients from holding connections open.
+func NewHTTPServer(cfg ServerConfig, handler http.Handler) *http.Server {
+	maxHeaderBytes := cfg.MaxHeaderBytes
+	if maxHeaderBytes <= 0 {
+		maxHeaderBytes = 64 << 10
+	}
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: secondsOr(cfg.ReadHeaderTimeoutSeconds, 10*time.Second),
+		ReadTimeout:       secondsOr(cfg.ReadTimeoutSeconds, 30*time.Second),
+		WriteTimeout:      secondsOr(cfg.WriteTimeoutSeconds, 60*time.Second),
+		IdleTimeout:       secondsOr(cfg.IdleTimeoutSeconds, 120*time.Second),
+		MaxHeaderBytes:    maxHeaderBytes,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			if _, ok := c.(*net.UnixConn); ok {
+				return context.WithValue(ctx, unixSocketKey{}, true)
+			}
+			return ctx
+		},
+	}
+}
+
+// ListenAddr returns the TCP address of the main listener: server.tls.listen
+// when TLS is enabled and set, else server.host:server.port
+func ListenAddr(cfg ServerConfig) string {
+	if cfg.TLS.Enabled() && cfg.TLS.Listen != "" {
+		return cfg.TLS.Listen
+	}
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+}
+
+// Listen opens the main listener: the Unix socket when server.socket is set,
+// otherwise TCP on ListenAddr
+func Listen(cfg ServerConfig) (net.Listener, error) {
+	if cfg.Socket == "" {
+		return net.Listen("tcp", ListenAddr(cfg))
+	}
+
+	// Remove a socket left behind by a previous run, but never a regular file
+	if info, err := os.Lstat(cfg.Socket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", cfg.Socket)
+		}
+		if err := os.Remove(cfg.Socket); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", cfg.Socket)
+	if err != nil {
+		return nil, err
+	}
+	// Owner and group only, so just the reverse proxy's group can connect
+	if err := os.Chmod(cfg.Socket, 0660); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("error setting socket permissions: %w", err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,276 @@
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookieName = "dashboard_session"
+	csrfCookieName    = "dashboard_csrf"
+	csrfHeaderName    = "X-CSRF-Token"
+)
+
+// sessionKey signs session cookies. Unless DASHBOARD_SESSION_SECRET is set it
+// is random per process, so a restart logs everybody out.
+var sessionKey []byte
+
+// sessionClaims is the signed content of a session cookie
+type sessionClaims struct {
+	UserID    string `json:"u"`
+	KeyID     string `json:"k"`
+	ExpiresAt int64  `json:"exp"`
+	CSRF      string `json:"csrf"`
+}
+
+// InitSessions prepares the session signing key
+func InitSessions() error {
+	if secret := os.Getenv("DASHBOARD_SESSION_SECRET"); secret != "" {
+		sessionKey = []byte(secret)
+		return nil
+	}
+
+	sessionKey = make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return fmt.Errorf("failed to generate session key: %w", err)
+	}
+	return nil
+}
+
+// sessionTTL returns the configured session lifetime (default 4 hours)
+func sessionTTL() time.Duration {
+	if Cfg.Auth.SessionTTLMinutes > 0 {
+		return time.Duration(Cfg.Auth.SessionTTLMinutes) * time.Minute
+	}
+	return 4 * time.Hour
+}
+
+func signSession(claims sessionClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	h := hmac.New(sha256.New, sessionKey)
+	h.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseSession verifies a session cookie and checks that it has not expired
+// and that its key has not been revoked since login
+func parseSession(token string) (*sessionClaims, string) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, "malformed session"
+	}
+
+	h := hmac.New(sha256.New, sessionKey)
+	h.Write([]byte(encoded))
+	expected := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return nil, "invalid session"
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "malformed session"
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, "malformed session"
+	}
+
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, "session expired"
+	}
+	if key, errMsg := keyring.Resolve(claims.KeyID); key == nil {
+		return nil, "session " + errMsg
+	}
+	return &claims, ""
+}
+
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || (fromTrustedProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https")
+}
+
+func setSessionCookies(w http.ResponseWriter, r *http.Request, session, csrf string, maxAge int) {
+	secure := isSecureRequest(r)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    session,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	// Readable by scripts so the frontend can echo it in the CSRF header
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    csrf,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// VerifySession checks the session cookie and, for state-changing methods,
+// the CSRF header. Returns: (userID, valid, errorMessage)
+func VerifySession(r *http.Request) (string, bool, string) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false, "missing session"
+	}
+
+	claims, errMsg := parseSession(cookie.Value)
+	if claims == nil {
+		return "", false, errMsg
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		token := r.Header.Get(csrfHeaderName)
+		if token == "" || !hmac.Equal([]byte(token), []byte(claims.CSRF)) {
+			return "", false, "missing or invalid CSRF token"
+		}
+	}
+
+	return claims.UserID, true, ""
+}
+
+// RequireAuth accepts either an HMAC signature or a session cookie with a
+// matching CSRF token. requireSecret has the same meaning as for RequireHMACAuth.
+func RequireAuth(handler http.Handler, requireSecret bool) http.Handler {
+	hmacHandler := RequireHMACAuth(handler, requireSecret)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-HMAC-Signature") != "" {
+			hmacHandler.ServeHTTP(w, r)
+			return
+		}
+		if _, err := r.Cookie(sessionCookieName); err != nil {
+			// No session either; let the HMAC check report what is missing
+			hmacHandler.ServeHTTP(w, r)
+			return
+		}
+
+		userID, valid, errMsg := VerifySession(r)
+		if !valid {
+			log.Printf("Session auth failed: %s from %s", errMsg, r.RemoteAddr)
+			http.Error(w, fmt.Sprintf("Unauthorized: %s", errMsg), http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r.WithContext(WithUser(r.Context(), userID)))
+	})
+}
+
+// OptionalAuth identifies the user from an HMAC signature or session cookie
+// when present and treats other requests as the default user
+func OptionalAuth(handler http.Handler) http.Handler {
+	hmacHandler := OptionalHMACAuth(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-HMAC-Signature") == "" {
+			if userID, valid, _ := VerifySession(r); valid {
+				handler.ServeHTTP(w, r.WithContext(WithUser(r.Context(), userID)))
+				return
+			}
+		}
+		hmacHandler.ServeHTTP(w, r)
+	})
+}
+
+// HandleLogin exchanges a key ID and secret for a session cookie
+func HandleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		KeyID  string `json:"keyId"`
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.KeyID == "" {
+		req.KeyID = DefaultKeyID
+	}
+
+	key, errMsg := keyring.Resolve(req.KeyID)
+	if key == nil || !hmac.Equal([]byte(req.Secret), []byte(key.Secret)) {
+		if key != nil {
+			errMsg = "invalid secret"
+		}
+		keyring.record(req.KeyID, "login: "+errMsg)
+		log.Printf("Login failed for key %s from %s: %s", req.KeyID, r.RemoteAddr, errMsg)
+		http.Error(w, "Unauthorized: invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	csrf, err := NewNonce()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	ttl := sessionTTL()
+	token, err := signSession(sessionClaims{
+		UserID:    key.User,
+		KeyID:     key.ID,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+		CSRF:      csrf,
+	})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	keyring.record(req.KeyID, "")
+	setSessionCookies(w, r, token, csrf, int(ttl.Seconds()))
+	log.Printf("Login succeeded for key %s (user %s)", key.ID, key.User)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"user":      key.User,
+		"expiresIn": int(ttl.Seconds()),
+	})
+}
+
+// HandleLogout clears the session cookies
+func HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	setSessionCookies(w, r, "", "", -1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleSession reports whether the request carries a valid session
+func HandleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, valid, _ := VerifySession(r)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"authenticated": valid,
+		"user":          userID,
+	})
+}
@@ -2,9 +2,11 @@ package backend
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"os"
 	"sync"
 	"time"
 
@@ -12,15 +14,43 @@ import (
 )
 
 var (
-	db            *sql.DB
-	TokenWeights  map[string]float64
+	db *sql.DB
+	// storeLock is held (shared) while the database is open, so db restore
+	// can tell that the server or another command is using it
+	storeLock *os.File
+	// TokenWeights holds learned token weights per user ID
+	TokenWeights  map[string]map[string]float64
 	TokenWeightMu sync.RWMutex
 )
 
-// OpenStore opens the SQLite database and creates tables if needed
+var errStoreLocked = errors.New("locked by another process")
+
+// lockStore takes the lock file next to the database
+func lockStore(dbPath string, exclusive bool) (*os.File, error) {
+	f, err := os.OpenFile(dbPath+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := flockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// OpenStore opens the SQLite database and applies pending schema migrations
 func OpenStore(dbPath string) error {
-	var err error
-	db, err = sql.Open("sqlite", dbPath)
+	lock, err := lockStore(dbPath, false)
+	if errors.Is(err, errStoreLocked) {
+		return fmt.Errorf("%s is being restored", dbPath)
+	} else if err != nil {
+		return err
+	}
+	storeLock = lock
+
+	// Wait for other processes' writes (e.g. a CLI command while the server
+	// runs) instead of failing with SQLITE_BUSY
+	db, err = sql.Open("sqlite", "file:"+dbPath+"?_pragma=busy_timeout(30000)")
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -30,40 +60,24 @@ func OpenStore(dbPath string) error {
 		return fmt.Errorf("failed to set WAL mode: %w", err)
 	}
 
-	if err := createTables(); err != nil {
-		return fmt.Errorf("failed to create tables: %w", err)
+	if err := migrate(dbPath); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	return nil
 }
 
-func createTables() error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS click_events (
-			id         INTEGER PRIMARY KEY AUTOINCREMENT,
-			item_key   TEXT NOT NULL,
-			title      TEXT NOT NULL,
-			link       TEXT NOT NULL,
-			source     TEXT NOT NULL,
-			category   TEXT NOT NULL,
-			clicked_at DATETIME NOT NULL
-		);
-
-		CREATE TABLE IF NOT EXISTS token_weights (
-			token      TEXT PRIMARY KEY,
-			weight     REAL NOT NULL,
-			updated_at DATETIME NOT NULL
-		);
-	`)
-	return err
-}
-
-// SaveClickEvent persists a single click event and updates token weights
+// SaveClickEvent persists a single click event and updates the clicking user's token weights
 func SaveClickEvent(feedback ClickFeedback) error {
+	userID := feedback.UserID
+	if userID == "" {
+		userID = DefaultUserID
+	}
+
 	_, err := db.Exec(
-		`INSERT INTO click_events (item_key, title, link, source, category, clicked_at)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		feedback.ItemKey, feedback.ItemTitle, feedback.ItemLink,
+		`INSERT INTO click_events (user_id, item_key, title, link, source, category, clicked_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, feedback.ItemKey, feedback.ItemTitle, feedback.ItemLink,
 		feedback.Source, feedback.Category, feedback.Timestamp,
 	)
 	if err != nil {
@@ -81,14 +95,21 @@ func SaveClickEvent(feedback ClickFeedback) error {
 	TokenWeightMu.Lock()
 	defer TokenWeightMu.Unlock()
 
+	weights := TokenWeights[userID]
+	if weights == nil {
+		weights = make(map[string]float64)
+		TokenWeights[userID] = weights
+	}
+
+	defer BumpCacheGeneration()
 	for _, token := range tokens {
-		TokenWeights[token] += weightPerToken
+		weights[token] += weightPerToken
 
 		_, err := db.Exec(
-			`INSERT INTO token_weights (token, weight, updated_at) VALUES (?, ?, ?)
-			 ON CONFLICT(token) DO UPDATE SET weight = ?, updated_at = ?`,
-			token, TokenWeights[token], time.Now(),
-			TokenWeights[token], time.Now(),
+			`INSERT INTO token_weights (user_id, token, weight, updated_at) VALUES (?, ?, ?, ?)
+			 ON CONFLICT(user_id, token) DO UPDATE SET weight = ?, updated_at = ?`,
+			userID, token, weights[token], time.Now(),
+			weights[token], time.Now(),
 		)
 		if err != nil {
 			log.Printf("Failed to save token weight for %q: %v", token, err)
@@ -103,9 +124,9 @@ func LoadTokenWeights() error {
 	TokenWeightMu.Lock()
 	defer TokenWeightMu.Unlock()
 
-	TokenWeights = make(map[string]float64)
+	TokenWeights = make(map[string]map[string]float64)
 
-	rows, err := db.Query("SELECT token, weight FROM token_weights")
+	rows, err := db.Query("SELECT user_id, token, weight FROM token_weights")
 	if err != nil {
 		return fmt.Errorf("failed to load token weights: %w", err)
 	}
@@ -113,16 +134,20 @@ func LoadTokenWeights() error {
 
 	count := 0
 	for rows.Next() {
-		var token string
+		var userID, token string
 		var weight float64
-		if err := rows.Scan(&token, &weight); err != nil {
+		if err := rows.Scan(&userID, &token, &weight); err != nil {
 			return fmt.Errorf("failed to scan token weight: %w", err)
 		}
-		TokenWeights[token] = weight
+		if TokenWeights[userID] == nil {
+			TokenWeights[userID] = make(map[string]float64)
+		}
+		TokenWeights[userID][token] = weight
 		count++
 	}
 
-	log.Printf("Loaded %d token weights from database", count)
+	BumpCacheGeneration()
+	log.Printf("Loaded %d token weights for %d users from database", count, len(TokenWeights))
 	return rows.Err()
 }
 
@@ -139,13 +164,14 @@ func ApplyTokenDecay() error {
 	defer TokenWeightMu.Unlock()
 
 	now := time.Now()
-	rows, err := db.Query("SELECT token, weight, updated_at FROM token_weights")
+	rows, err := db.Query("SELECT user_id, token, weight, updated_at FROM token_weights")
 	if err != nil {
 		return fmt.Errorf("failed to read token weights for decay: %w", err)
 	}
 	defer rows.Close()
 
 	type entry struct {
+		userID    string
 		token     string
 		weight    float64
 		updatedAt time.Time
@@ -153,7 +179,7 @@ func ApplyTokenDecay() error {
 	var entries []entry
 	for rows.Next() {
 		var e entry
-		if err := rows.Scan(&e.token, &e.weight, &e.updatedAt); err != nil {
+		if err := rows.Scan(&e.userID, &e.token, &e.weight, &e.updatedAt); err != nil {
 			return err
 		}
 		entries = append(entries, e)
@@ -174,17 +200,24 @@ func ApplyTokenDecay() error {
 			continue // skip very recent entries
 		}
 		decayed := e.weight * math.Pow(decay, daysSinceUpdate)
-		TokenWeights[e.token] = decayed
+		if TokenWeights[e.userID] == nil {
+			TokenWeights[e.userID] = make(map[string]float64)
+		}
+		TokenWeights[e.userID][e.token] = decayed
 
 		if _, err := tx.Exec(
-			"UPDATE token_weights SET weight = ?, updated_at = ? WHERE token = ?",
-			decayed, now, e.token,
+			"UPDATE token_weights SET weight = ?, updated_at = ? WHERE user_id = ? AND token = ?",
+			decayed, now, e.userID, e.token,
 		); err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	BumpCacheGeneration()
+	return nil
 }
 
 // PruneOldEvents removes click events older than the retention window
@@ -206,4 +239,8 @@ func CloseStore() {
 	if db != nil {
 		db.Close()
 	}
+	if storeLock != nil {
+		storeLock.Close()
+		storeLock = nil
+	}
 }
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package backend
+
+import "os"
+
+// flockFile is a no-op where flock is unavailable; db restore then cannot
+// tell whether the server is running
+func flockFile(f *os.File, exclusive bool) error {
+	return nil
+}
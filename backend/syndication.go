@@ -0,0 +1,410 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	syndicationDefaultLimit = 50
+	syndicationMaxLimit     = 200
+)
+
+// syndicationFeed is the format-independent view of an outgoing feed
+type syndicationFeed struct {
+	Title       string
+	Description string
+	HomeURL     string
+	SelfURL     string
+	Items       []FeedItem
+}
+
+// updated returns the newest item date, which is used as Last-Modified
+func (f syndicationFeed) updated() time.Time {
+	var latest time.Time
+	for _, item := range f.Items {
+		if item.PublishedAt.After(latest) {
+			latest = item.PublishedAt
+		}
+	}
+	return latest
+}
+
+func itemID(item FeedItem) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	return item.Link
+}
+
+// RSS 2.0
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description,omitempty"`
+	Category    string  `xml:"category,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func renderRSS(f syndicationFeed) ([]byte, error) {
+	doc := rssDocument{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.HomeURL,
+			Description: f.Description,
+		},
+	}
+	if updated := f.updated(); !updated.IsZero() {
+		doc.Channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, item := range f.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{IsPermaLink: item.GUID == "" && item.Link != "", Value: itemID(item)},
+			PubDate:     item.PublishedAt.UTC().Format(time.RFC1123Z),
+			Description: item.Description,
+			Category:    item.Source,
+		})
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// Atom 1.0
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string        `xml:"title"`
+	ID        string        `xml:"id"`
+	Updated   string        `xml:"updated"`
+	Published string        `xml:"published"`
+	Link      *atomLink     `xml:"link,omitempty"`
+	Author    *atomAuthor   `xml:"author,omitempty"`
+	Category  *atomCategory `xml:"category,omitempty"`
+	Summary   *atomText     `xml:"summary,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func renderAtom(f syndicationFeed) ([]byte, error) {
+	updated := f.updated()
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+
+	doc := atomFeed{
+		Title:   f.Title,
+		ID:      f.SelfURL,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.SelfURL, Rel: "self"},
+			{Href: f.HomeURL, Rel: "alternate"},
+		},
+	}
+
+	for _, item := range f.Items {
+		published := item.PublishedAt.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        itemID(item),
+			Updated:   published,
+			Published: published,
+			Category:  &atomCategory{Term: item.Source},
+		}
+		if item.Link != "" {
+			entry.Link = &atomLink{Href: item.Link, Rel: "alternate"}
+		}
+		// Atom requires an author; fall back to the source name
+		entry.Author = &atomAuthor{Name: item.Source}
+		if item.Author != "" {
+			entry.Author.Name = item.Author
+		}
+		if item.Description != "" {
+			entry.Summary = &atomText{Type: "html", Value: item.Description}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// JSON Feed 1.1
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html"`
+	DatePublished string           `json:"date_published,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func renderJSONFeed(f syndicationFeed) ([]byte, error) {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.SelfURL,
+		Description: f.Description,
+		Items:       []jsonFeedItem{},
+	}
+
+	for _, item := range f.Items {
+		entry := jsonFeedItem{
+			ID:            itemID(item),
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   item.Description,
+			DatePublished: item.PublishedAt.UTC().Format(time.RFC3339),
+			Tags:          []string{item.Category, item.Source},
+		}
+		if item.Author != "" {
+			entry.Authors = []jsonFeedAuthor{{Name: item.Author}}
+		}
+		doc.Items = append(doc.Items, entry)
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// syndicationFormats maps the format query parameter to a renderer and content type
+var syndicationFormats = map[string]struct {
+	render      func(syndicationFeed) ([]byte, error)
+	contentType string
+}{
+	"rss":  {renderRSS, "application/rss+xml; charset=utf-8"},
+	"atom": {renderAtom, "application/atom+xml; charset=utf-8"},
+	"json": {renderJSONFeed, "application/feed+json; charset=utf-8"},
+}
+
+// requestBaseURL returns the externally visible URL of the dashboard root:
+// server.publicURL, or else the configured host and port plus
+// server.basePath. The Host header is never used, since clients choose it
+// and the rendered feeds are cached.
+func requestBaseURL(r *http.Request) string {
+	if Cfg.Server.PublicURL != "" {
+		return strings.TrimSuffix(Cfg.Server.PublicURL, "/")
+	}
+	scheme := "http"
+	if isSecureRequest(r) {
+		scheme = "https"
+	}
+	host := Cfg.Server.Host
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	if Cfg.Server.Socket == "" {
+		host = net.JoinHostPort(host, strconv.Itoa(Cfg.Server.Port))
+	}
+	return scheme + "://" + host + basePath
+}
+
+// syndicationLimit reads ?limit= (default 50, at most 200)
+func syndicationLimit(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return syndicationDefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", raw)
+	}
+	return min(limit, syndicationMaxLimit), nil
+}
+
+// writeSyndicationFeed renders a feed in the requested format (?format=rss,
+// atom or json; default rss) and serves it with ETag and Last-Modified so
+// that readers can poll with conditional requests
+func writeSyndicationFeed(w http.ResponseWriter, r *http.Request, f syndicationFeed) {
+	formatName := strings.ToLower(r.URL.Query().Get("format"))
+	if formatName == "" {
+		formatName = "rss"
+	}
+	format, ok := syndicationFormats[formatName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown format %q (expected rss, atom or json)", formatName), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := syndicationLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(f.Items) > limit {
+		f.Items = f.Items[:limit]
+	}
+	f.SelfURL = requestBaseURL(r) + r.URL.RequestURI()
+	if f.HomeURL == "" {
+		f.HomeURL = requestBaseURL(r) + "/"
+	}
+
+	body, err := format.render(f)
+	if err != nil {
+		http.Error(w, "Failed to render feed", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	// ServeContent answers If-None-Match / If-Modified-Since with 304
+	http.ServeContent(w, r, "", f.updated(), bytes.NewReader(body))
+}
+
+// mergeGroupItems flattens feed groups into a single newest-first list
+func mergeGroupItems(groups []FeedGroup) []FeedItem {
+	var items []FeedItem
+	for _, group := range groups {
+		items = append(items, group.Items...)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].PublishedAt.After(items[j].PublishedAt)
+	})
+	return items
+}
+
+// HandleCategoryFeed serves all items of one category as a feed
+func HandleCategoryFeed(w http.ResponseWriter, r *http.Request) {
+	categoryName := r.PathValue("category")
+
+	var groups []FeedGroup
+	for _, group := range GetAllFeeds() {
+		if strings.EqualFold(group.Category, categoryName) {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeSyndicationFeed(w, r, syndicationFeed{
+		Title:       "Dashboard: " + groups[0].Category,
+		Description: fmt.Sprintf("Latest items from the %s category", groups[0].Category),
+		Items:       mergeGroupItems(groups),
+	})
+}
+
+// HandleSourceFeed serves the items of a single source as a feed
+func HandleSourceFeed(w http.ResponseWriter, r *http.Request) {
+	categoryName := r.PathValue("category")
+	sourceName := r.PathValue("source")
+
+	for _, group := range GetAllFeeds() {
+		if !strings.EqualFold(group.Category, categoryName) || group.Source != sourceName {
+			continue
+		}
+		writeSyndicationFeed(w, r, syndicationFeed{
+			Title:       fmt.Sprintf("Dashboard: %s (%s)", group.Source, group.Category),
+			Description: fmt.Sprintf("Latest items from %s", group.Source),
+			HomeURL:     group.SiteURL,
+			Items:       group.Items,
+		})
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// HandleTopRatedFeed serves the requesting user's top-rated items as a feed.
+// The ranking reveals what the user reads, so the request must be signed or
+// come with a session; anonymous readers are refused.
+func HandleTopRatedFeed(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := AuthenticatedUser(r.Context())
+	if !authenticated {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	limit, err := syndicationLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeSyndicationFeed(w, r, syndicationFeed{
+		Title:       "Dashboard: top rated",
+		Description: "Items ranked by learned click preferences",
+		Items:       RankItems(userID, limit),
+	})
+}
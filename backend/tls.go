@@ -0,0 +1,149 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate/key pair from disk and picks up renewed
+// files without a restart
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+// NewCertReloader loads the initial certificate and fails if it is invalid
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	cr := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *CertReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+func (cr *CertReloader) load() error {
+	certTime, keyTime, err := cr.modTimes()
+	if err != nil {
+		return fmt.Errorf("error reading TLS certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate %s: %w", cr.certFile, err)
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.certTime, cr.keyTime = certTime, keyTime
+	cr.mu.Unlock()
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// Watch reloads the certificate when the cert or key file changes. A broken
+// pair (e.g. cert written but key not yet) keeps the previous certificate
+// and is retried on the next tick.
+func (cr *CertReloader) Watch(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			certTime, keyTime, err := cr.modTimes()
+			if err != nil {
+				log.Printf("Warning: cannot stat TLS certificate: %v", err)
+				continue
+			}
+
+			cr.mu.RLock()
+			changed := !certTime.Equal(cr.certTime) || !keyTime.Equal(cr.keyTime)
+			cr.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := cr.load(); err != nil {
+				log.Printf("Warning: keeping previous TLS certificate: %v", err)
+				continue
+			}
+			log.Printf("Reloaded TLS certificate from %s", cr.certFile)
+		}
+	}
+}
+
+// NewTLSConfig returns modern TLS defaults: TLS 1.2+, forward-secret AEAD
+// cipher suites only, certificates served by the reloader
+func NewTLSConfig(cr *CertReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		GetCertificate: cr.GetCertificate,
+	}
+}
+
+// HTTPSRedirectHandler redirects plain HTTP requests to the HTTPS listener
+func HTTPSRedirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		// Only GET/HEAD can be redirected safely; others would lose their body
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
+
+// Enabled reports whether HTTPS is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
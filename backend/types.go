@@ -11,28 +11,129 @@ type Config struct {
 	Feeds   []FeedCategory `yaml:"feeds"`
 	Refresh RefreshConfig  `yaml:"refresh"`
 	ML      MLConfig       `yaml:"ml"`
+	Auth    AuthConfig     `yaml:"auth"`
 }
 
 type ServerConfig struct {
 	Port int `yaml:"port"`
+	// Interface to bind to (default all); ignored when socket is set
+	Host string `yaml:"host"`
+	// Listen on a Unix domain socket instead of TCP (for a local reverse proxy)
+	Socket string `yaml:"socket"`
+	// URL prefix the dashboard is served under, e.g. "/dashboard"
+	BasePath string `yaml:"basePath"`
+	// Externally visible URL of the dashboard root, including basePath, for
+	// absolute links in syndication feeds (default http(s)://host:port)
+	PublicURL string `yaml:"publicURL"`
+	// Connection timeouts (defaults 10s/30s/60s/120s) and request header limit (default 64KB)
+	ReadHeaderTimeoutSeconds int `yaml:"readHeaderTimeoutSeconds"`
+	ReadTimeoutSeconds       int `yaml:"readTimeoutSeconds"`
+	WriteTimeoutSeconds      int `yaml:"writeTimeoutSeconds"`
+	IdleTimeoutSeconds       int `yaml:"idleTimeoutSeconds"`
+	MaxHeaderBytes           int `yaml:"maxHeaderBytes"`
+	// CIDRs of reverse proxies allowed to set forwardedHeader
+	TrustedProxies []string `yaml:"trustedProxies"`
+	// The one header those proxies write the client address to:
+	// X-Forwarded-For (default), Forwarded or X-Real-IP
+	ForwardedHeader string         `yaml:"forwardedHeader"`
+	Limits          LimitsConfig   `yaml:"limits"`
+	CORS            CORSConfig     `yaml:"cors"`
+	Security        SecurityConfig `yaml:"security"`
+	TLS             TLSConfig      `yaml:"tls"`
+}
+
+// TLSConfig enables HTTPS when certFile and keyFile are set. The files are
+// re-read when they change, so renewals need no restart.
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// HTTPS listen address (default ":<port>")
+	Listen string `yaml:"listen"`
+	// Plain HTTP port that redirects to HTTPS (0 disables)
+	RedirectHTTPPort int `yaml:"redirectHTTPPort"`
+}
+
+// SecurityConfig tunes the security headers sent with every response (hot-reloadable)
+type SecurityConfig struct {
+	// Replaces the built-in strict policy (see defaultCSP)
+	ContentSecurityPolicy string `yaml:"contentSecurityPolicy"`
+	// Report violations without blocking, for trying out a new policy
+	CSPReportOnly  bool   `yaml:"cspReportOnly"`
+	ReferrerPolicy string `yaml:"referrerPolicy"`
+	// Strict-Transport-Security on TLS requests (default 1 year, -1 disables)
+	HSTSMaxAgeSeconds     int  `yaml:"hstsMaxAgeSeconds"`
+	HSTSIncludeSubdomains bool `yaml:"hstsIncludeSubdomains"`
+}
+
+// CORSConfig controls which other origins may call the API (hot-reloadable)
+type CORSConfig struct {
+	// Exact origins ("https://app.example.com"), subdomain wildcards
+	// ("https://*.example.com") or "*"; empty allows same-origin only
+	AllowedOrigins   []string `yaml:"allowedOrigins"`
+	AllowCredentials bool     `yaml:"allowCredentials"`
+	// Preflight cache lifetime (default 600)
+	MaxAgeSeconds  int      `yaml:"maxAgeSeconds"`
+	AllowedMethods []string `yaml:"allowedMethods"`
+	AllowedHeaders []string `yaml:"allowedHeaders"`
+	ExposedHeaders []string `yaml:"exposedHeaders"`
+	// Per-path overrides of methods and headers; a path also covers its subpaths
+	Routes map[string]CORSRoute `yaml:"routes"`
+}
+
+type CORSRoute struct {
+	AllowedMethods []string `yaml:"allowedMethods"`
+	AllowedHeaders []string `yaml:"allowedHeaders"`
+}
+
+// LimitsConfig defines per-route request policies (hot-reloadable)
+type LimitsConfig struct {
+	// IPs or CIDRs that are never rate limited
+	Allowlist []string `yaml:"allowlist"`
+	// Keyed by route path, e.g. "/api/feedback"; unset fields keep their defaults
+	Routes map[string]RoutePolicy `yaml:"routes"`
+}
+
+type RoutePolicy struct {
+	RatePerMinute int   `yaml:"ratePerMinute"`
+	Burst         int   `yaml:"burst"` // defaults to ratePerMinute
+	MaxBodyBytes  int64 `yaml:"maxBodyBytes"`
+	RequireHMAC   *bool `yaml:"requireHMAC"` // HMAC signature or session login required
 }
 
 type FeedCategory struct {
 	Category string       `yaml:"category"`
 	Color    string       `yaml:"color"`
 	Sources  []FeedSource `yaml:"sources"`
+	Filters  FilterConfig `yaml:"filters,omitempty"`
 }
 
 type FeedSource struct {
-	Name string `yaml:"name"`
-	URL  string `yaml:"url"`
-	Site string `yaml:"siteUrl" json:"siteUrl"`
+	Name    string       `yaml:"name"`
+	URL     string       `yaml:"url"`
+	Site    string       `yaml:"siteUrl,omitempty" json:"siteUrl"`
+	Filters FilterConfig `yaml:"filters,omitempty"`
+}
+
+// FilterConfig drops unwanted items before they enter the feed cache
+type FilterConfig struct {
+	Include         []FilterRule `yaml:"include,omitempty"`
+	Exclude         []FilterRule `yaml:"exclude,omitempty"`
+	MinTitleLength  int          `yaml:"minTitleLength,omitempty"`
+	DropWithoutLink bool         `yaml:"dropWithoutLink,omitempty"`
+}
+
+// FilterRule matches a regular expression against a single item field
+type FilterRule struct {
+	Field   string `yaml:"field"` // title, link or author
+	Pattern string `yaml:"pattern"`
 }
 
 type RefreshConfig struct {
 	IntervalMinutes              int     `yaml:"intervalMinutes"`
 	NotModifiedBackoffMultiplier float64 `yaml:"notModifiedBackoffMultiplier"`
 	MaxIntervalMinutes           int     `yaml:"maxIntervalMinutes"`
+	// Days of fetched items kept for /api/sources/{id}/items (default 30)
+	HistoryRetentionDays int `yaml:"historyRetentionDays"`
 }
 
 type MLConfig struct {
@@ -41,6 +142,43 @@ type MLConfig struct {
 	TokenDecayPerDay float64 `yaml:"tokenDecayPerDay"`
 	DBPath           string  `yaml:"dbPath"`
 	RetentionDays    int     `yaml:"retentionDays"`
+	// Scheduled online backups of the database (disabled without dir)
+	Backup BackupConfig `yaml:"backup"`
+}
+
+type BackupConfig struct {
+	Dir string `yaml:"dir"`
+	// Time between backups (default 24) and number of backups kept (default 7)
+	IntervalHours int `yaml:"intervalHours"`
+	Keep          int `yaml:"keep"`
+}
+
+type AuthConfig struct {
+	// Optional YAML keyring file with rotating HMAC keys
+	KeyringPath string `yaml:"keyringPath"`
+	// Accepted clock skew for signed request timestamps (defaults 120s / 30s)
+	MaxAgeSeconds    int `yaml:"maxAgeSeconds"`
+	MaxFutureSeconds int `yaml:"maxFutureSeconds"`
+	// Accept signatures without a nonce (replayable, for old clients only)
+	AllowMissingNonce bool `yaml:"allowMissingNonce"`
+	// Maximum number of remembered nonces per key ID (default 10000)
+	NonceCacheSize int `yaml:"nonceCacheSize"`
+	// Lifetime of login session cookies (default 240)
+	SessionTTLMinutes int `yaml:"sessionTTLMinutes"`
+}
+
+// SkewWindow returns how far in the past and future a signed request
+// timestamp may be
+func (c AuthConfig) SkewWindow() (time.Duration, time.Duration) {
+	maxAge := 2 * time.Minute
+	if c.MaxAgeSeconds > 0 {
+		maxAge = time.Duration(c.MaxAgeSeconds) * time.Second
+	}
+	maxFuture := 30 * time.Second
+	if c.MaxFutureSeconds > 0 {
+		maxFuture = time.Duration(c.MaxFutureSeconds) * time.Second
+	}
+	return maxAge, maxFuture
 }
 
 // Domain models
@@ -51,6 +189,7 @@ type FeedItem struct {
 	Source      string    `json:"source"`
 	Category    string    `json:"category"`
 	Description string    `json:"description"`
+	Author      string    `json:"author"`
 	GUID        string    `json:"guid"`
 	Score       float64   `json:"score"`
 	Age         string    `json:"age"`
@@ -58,11 +197,13 @@ type FeedItem struct {
 
 // FeedGroup represents a single feed source and its items
 type FeedGroup struct {
+	ID       string     `json:"id"` // see SourceID
 	Source   string     `json:"source"`
 	Category string     `json:"category"`
 	Color    string     `json:"color"`
 	SiteURL  string     `json:"siteUrl"`
 	Items    []FeedItem `json:"items"`
+	Filtered int        `json:"filtered"` // items dropped by filters on the last fetch
 }
 
 type TopRatedItem struct {
@@ -77,6 +218,7 @@ type APIResponse struct {
 }
 
 type ClickFeedback struct {
+	UserID    string    `json:"-"` // set from the authenticated request, never from the body
 	ItemKey   string    `json:"itemKey"`
 	ItemTitle string    `json:"itemTitle"`
 	ItemLink  string    `json:"itemLink"`
@@ -93,6 +235,7 @@ type FeedCacheEntry struct {
 	LastFetch    time.Time
 	NextRefresh  time.Time
 	Interval     time.Duration
+	Filtered     int
 }
 
 // Global state
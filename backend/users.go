@@ -0,0 +1,267 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultUserID owns requests signed with the master secret and all
+// preferences recorded before multi-user support existed
+const DefaultUserID = "default"
+
+// User is a dashboard profile with its own HMAC secret and ML preferences
+type User struct {
+	ID        string    `json:"id"`
+	Secret    string    `json:"-"`
+	Admin     bool      `json:"admin"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var (
+	users   = map[string]*User{}
+	usersMu sync.RWMutex
+
+	userIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// WithUser returns a copy of ctx carrying the authenticated user ID
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userContextKey, userID)
+}
+
+// UserFromContext returns the authenticated user ID, or DefaultUserID for
+// anonymous requests
+func UserFromContext(ctx context.Context) string {
+	if userID, ok := ctx.Value(userContextKey).(string); ok && userID != "" {
+		return userID
+	}
+	return DefaultUserID
+}
+
+// AuthenticatedUser returns the user ID set by an authentication middleware.
+// Unlike UserFromContext it does not fall back to the default user.
+func AuthenticatedUser(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userContextKey).(string)
+	return userID, ok && userID != ""
+}
+
+// LoadUsers reads all user profiles from the database into memory
+func LoadUsers() error {
+	rows, err := db.Query("SELECT id, secret, is_admin, created_at FROM users")
+	if err != nil {
+		return fmt.Errorf("failed to load users: %w", err)
+	}
+	defer rows.Close()
+
+	loaded := map[string]*User{}
+	for rows.Next() {
+		u := &User{}
+		if err := rows.Scan(&u.ID, &u.Secret, &u.Admin, &u.CreatedAt); err != nil {
+			return fmt.Errorf("failed to scan user: %w", err)
+		}
+		loaded[u.ID] = u
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	usersMu.Lock()
+	users = loaded
+	usersMu.Unlock()
+
+	log.Printf("Loaded %d user profiles from database", len(loaded))
+	return nil
+}
+
+// LookupUser returns the user profile with the given ID
+func LookupUser(userID string) (*User, bool) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	u, ok := users[userID]
+	return u, ok
+}
+
+// HasUsers reports whether any user profiles exist
+func HasUsers() bool {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	return len(users) > 0
+}
+
+// ListUsers returns all user profiles sorted by ID
+func ListUsers() []User {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+
+	result := make([]User, 0, len(users))
+	for _, u := range users {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// IsAdmin reports whether a user may manage other users. The default user
+// is always an admin, and so is every key that signs as it: the
+// DASHBOARD_HMAC_SECRET and DASHBOARD_HMAC_KEYS keys and keyring keys with
+// user "default". Give non-admin clients a keyring key mapped to their own
+// user profile.
+func IsAdmin(userID string) bool {
+	if userID == DefaultUserID {
+		return true
+	}
+	u, ok := LookupUser(userID)
+	return ok && u.Admin
+}
+
+// CreateUser stores a new user profile with a freshly generated secret
+func CreateUser(userID string, admin bool) (*User, error) {
+	if !userIDPattern.MatchString(userID) {
+		return nil, fmt.Errorf("invalid user id %q (allowed: letters, digits, '-' and '_', max 64)", userID)
+	}
+	if userID == DefaultUserID {
+		return nil, fmt.Errorf("user id %q is reserved", userID)
+	}
+	if _, exists := LookupUser(userID); exists {
+		return nil, fmt.Errorf("user %q already exists", userID)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	u := &User{
+		ID:        userID,
+		Secret:    base64.StdEncoding.EncodeToString(buf),
+		Admin:     admin,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := db.Exec(
+		"INSERT INTO users (id, secret, is_admin, created_at) VALUES (?, ?, ?, ?)",
+		u.ID, u.Secret, u.Admin, u.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to save user: %w", err)
+	}
+
+	usersMu.Lock()
+	users[u.ID] = u
+	usersMu.Unlock()
+
+	return u, nil
+}
+
+// DeleteUser removes a user profile together with its clicks and weights
+func DeleteUser(userID string) error {
+	if _, exists := LookupUser(userID); !exists {
+		return fmt.Errorf("user %q not found", userID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"DELETE FROM click_events WHERE user_id = ?",
+		"DELETE FROM token_weights WHERE user_id = ?",
+		"DELETE FROM users WHERE id = ?",
+	} {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return fmt.Errorf("failed to delete user %q: %w", userID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	usersMu.Lock()
+	delete(users, userID)
+	usersMu.Unlock()
+
+	TokenWeightMu.Lock()
+	delete(TokenWeights, userID)
+	TokenWeightMu.Unlock()
+	dropDashboardCache(userID)
+
+	return nil
+}
+
+// RequireAdmin rejects requests whose authenticated user is not an admin.
+// Must be wrapped by an authentication middleware such as RequireHMACAuth;
+// anonymous requests are always rejected.
+func RequireAdmin(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, authenticated := AuthenticatedUser(r.Context())
+		if !authenticated || !IsAdmin(userID) {
+			log.Printf("Admin access denied for user %q on %s", userID, r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// HandleAdminUsers lists (GET), creates (POST) and deletes (DELETE ?id=) user profiles
+func HandleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ListUsers())
+
+	case http.MethodPost:
+		var req struct {
+			ID    string `json:"id"`
+			Admin bool   `json:"admin"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		u, err := CreateUser(req.ID, req.Admin)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Created user %q (admin=%v)", u.ID, u.Admin)
+
+		// The secret is only ever returned here
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":     u.ID,
+			"admin":  u.Admin,
+			"secret": u.Secret,
+		})
+
+	case http.MethodDelete:
+		userID := r.URL.Query().Get("id")
+		if err := DeleteUser(userID); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Deleted user %q", userID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,372 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// hexColorPattern matches #rgb and #rrggbb
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// configSource remembers where config values came from, so validation
+// errors can point at a file and line (or the overriding variable)
+type configSource struct {
+	root  *yaml.Node
+	files map[*yaml.Node]string
+	env   []string // applied DASHBOARD_* overrides
+}
+
+func (src *configSource) add(file string, n *yaml.Node) {
+	src.files[n] = file
+	for _, child := range n.Content {
+		src.add(file, child)
+	}
+}
+
+// splitConfigPath turns "feeds[1].sources[0].url" into
+// ["feeds", 1, "sources", 0, "url"]
+func splitConfigPath(path string) []any {
+	var parts []any
+	for _, segment := range strings.Split(path, ".") {
+		name, rest, _ := strings.Cut(segment, "[")
+		parts = append(parts, name)
+		for rest != "" {
+			var index string
+			index, rest, _ = strings.Cut(rest, "]")
+			if i, err := strconv.Atoi(index); err == nil {
+				parts = append(parts, i)
+			}
+			rest = strings.TrimPrefix(rest, "[")
+		}
+	}
+	return parts
+}
+
+// position returns "file:line" of the deepest node found along path, or the
+// environment variable that overrode it
+func (src *configSource) position(path string) string {
+	parts := splitConfigPath(path)
+
+	envName := strings.TrimSuffix(envPrefix, "_")
+	for _, part := range parts {
+		name, ok := part.(string)
+		if !ok {
+			break
+		}
+		envName += "_" + strings.ToUpper(name)
+		if slices.Contains(src.env, envName) {
+			return envName
+		}
+	}
+
+	if src.root == nil {
+		return ""
+	}
+	n, line := src.root, 0
+	for _, part := range parts {
+		var next *yaml.Node
+		switch p := part.(type) {
+		case string:
+			if n.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(n.Content); i += 2 {
+					if n.Content[i].Value == p {
+						next, line = n.Content[i+1], n.Content[i].Line
+						break
+					}
+				}
+			}
+		case int:
+			if n.Kind == yaml.SequenceNode && p < len(n.Content) {
+				next = n.Content[p]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	if line == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", src.files[n], line)
+}
+
+// configValidator collects all problems instead of stopping at the first
+type configValidator struct {
+	src  *configSource
+	errs []error
+}
+
+func (v *configValidator) errorf(path, format string, args ...any) {
+	msg := path + ": " + fmt.Sprintf(format, args...)
+	if pos := v.src.position(path); pos != "" {
+		msg = pos + ": " + msg
+	}
+	v.errs = append(v.errs, errors.New(msg))
+}
+
+func (v *configValidator) check(ok bool, path, format string, args ...any) {
+	if !ok {
+		v.errorf(path, format, args...)
+	}
+}
+
+func (v *configValidator) nonNegative(path string, value int) {
+	v.check(value >= 0, path, "must not be negative, got %d", value)
+}
+
+// checkConfigFields reports keys that do not exist in the config structs,
+// typically typos or wrong capitalization that would otherwise be ignored
+func checkConfigFields(file string, n *yaml.Node, t reflect.Type, path string) []error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	var errs []error
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			if tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); tag != "" && tag != "-" {
+				fields[tag] = t.Field(i).Type
+			}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			ft, ok := fields[key.Value]
+			if !ok {
+				hint := ""
+				for name := range fields {
+					if strings.EqualFold(name, key.Value) {
+						hint = fmt.Sprintf(" (did you mean %q?)", name)
+					}
+				}
+				errs = append(errs, fmt.Errorf("%s:%d: unknown field %q%s", file, key.Line, join(key.Value), hint))
+				continue
+			}
+			errs = append(errs, checkConfigFields(file, n.Content[i+1], ft, join(key.Value))...)
+		}
+	case t.Kind() == reflect.Map && n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			if path == "server.limits.routes" {
+				if _, ok := defaultRoutePolicies[key.Value]; !ok {
+					errs = append(errs, fmt.Errorf("%s:%d: unknown route %q%s", file, key.Line, key.Value, routeHint(key.Value)))
+					continue
+				}
+			}
+			errs = append(errs, checkConfigFields(file, n.Content[i+1], t.Elem(), join(n.Content[i].Value))...)
+		}
+	case t.Kind() == reflect.Slice && n.Kind == yaml.SequenceNode:
+		for i, item := range n.Content {
+			errs = append(errs, checkConfigFields(file, item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return errs
+}
+
+// checkConfigFile strictly checks a single file: unknown fields and values
+// of the wrong type, each with its line
+func checkConfigFile(file string, n *yaml.Node) []error {
+	errs := checkConfigFields(file, n, reflect.TypeOf(Config{}), "")
+
+	var scratch Config
+	if err := n.Decode(&scratch); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return append(errs, fmt.Errorf("%s: %w", file, err))
+		}
+		for _, msg := range typeErr.Errors {
+			// "line 12: cannot unmarshal ..."
+			if rest, ok := strings.CutPrefix(msg, "line "); ok {
+				errs = append(errs, fmt.Errorf("%s:%s", file, rest))
+			} else {
+				errs = append(errs, fmt.Errorf("%s: %s", file, msg))
+			}
+		}
+	}
+	return errs
+}
+
+// applyConfigDefaults fills in settings whose zero value would break the
+// server (e.g. a refresh interval of 0 refetches continuously)
+func applyConfigDefaults(cfg *Config) {
+	if cfg.Server.Port == 0 && cfg.Server.Socket == "" {
+		cfg.Server.Port = 8080
+	}
+
+	r := &cfg.Refresh
+	if r.IntervalMinutes == 0 {
+		r.IntervalMinutes = 15
+	}
+	if r.NotModifiedBackoffMultiplier == 0 {
+		r.NotModifiedBackoffMultiplier = 2
+	}
+	if r.MaxIntervalMinutes == 0 {
+		r.MaxIntervalMinutes = max(240, r.IntervalMinutes)
+	}
+	if r.HistoryRetentionDays == 0 {
+		r.HistoryRetentionDays = defaultHistoryRetentionDays
+	}
+
+	ml := &cfg.ML
+	if ml.MaxItemAgeHours == 0 {
+		ml.MaxItemAgeHours = 72
+	}
+	if ml.ClickWeight == 0 {
+		ml.ClickWeight = 1
+	}
+	if ml.DBPath == "" {
+		ml.DBPath = "data/ml_preferences.db"
+	}
+	if ml.RetentionDays == 0 {
+		ml.RetentionDays = 90
+	}
+	if ml.Backup.Dir != "" {
+		if ml.Backup.IntervalHours == 0 {
+			ml.Backup.IntervalHours = 24
+		}
+		if ml.Backup.Keep == 0 {
+			ml.Backup.Keep = 7
+		}
+	}
+}
+
+func validHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validateConfig checks a decoded config with defaults applied
+func validateConfig(cfg *Config, src *configSource) error {
+	v := &configValidator{src: src}
+
+	s := cfg.Server
+	v.check(s.Socket != "" || (s.Port > 0 && s.Port <= 65535), "server.port", "must be between 1 and 65535, got %d", s.Port)
+	if _, err := normalizeBasePath(s.BasePath); err != nil {
+		v.errorf("server.basePath", "%v", err)
+	}
+	if s.PublicURL != "" {
+		u, err := url.Parse(s.PublicURL)
+		v.check(validHTTPURL(s.PublicURL) && err == nil && u.RawQuery == "" && u.Fragment == "",
+			"server.publicURL", "must be an http(s) URL without query or fragment, got %q", s.PublicURL)
+	}
+	v.nonNegative("server.readHeaderTimeoutSeconds", s.ReadHeaderTimeoutSeconds)
+	v.nonNegative("server.readTimeoutSeconds", s.ReadTimeoutSeconds)
+	v.nonNegative("server.writeTimeoutSeconds", s.WriteTimeoutSeconds)
+	v.nonNegative("server.idleTimeoutSeconds", s.IdleTimeoutSeconds)
+	v.nonNegative("server.maxHeaderBytes", s.MaxHeaderBytes)
+	if s.TLS.Enabled() {
+		v.check(s.TLS.CertFile != "", "server.tls", "certFile is required with keyFile")
+		v.check(s.TLS.KeyFile != "", "server.tls", "keyFile is required with certFile")
+	}
+	v.check(s.TLS.RedirectHTTPPort >= 0 && s.TLS.RedirectHTTPPort <= 65535, "server.tls.redirectHTTPPort", "must be between 0 and 65535")
+	if _, err := parseTrustedProxies(s.TrustedProxies); err != nil {
+		v.errorf("server.trustedProxies", "%v", err)
+	}
+	if _, err := parseForwardedHeader(s.ForwardedHeader); err != nil {
+		v.errorf("server.forwardedHeader", "%v", err)
+	}
+	if _, err := compileLimits(s.Limits); err != nil {
+		v.errorf("server.limits", "%v", err)
+	}
+	if _, err := compileCORS(s.CORS); err != nil {
+		v.errorf("server.cors", "%v", err)
+	}
+	if err := validateSecurity(s.Security); err != nil {
+		v.errorf("server.security", "%v", err)
+	}
+
+	// A category may be listed more than once (e.g. in a config.d fragment);
+	// its sources are combined, so names must be unique across all entries
+	sourcePaths := map[string]string{}
+	for i, category := range cfg.Feeds {
+		cp := fmt.Sprintf("feeds[%d]", i)
+		v.check(strings.TrimSpace(category.Category) != "", cp+".category", "must not be empty")
+		v.check(category.Color == "" || hexColorPattern.MatchString(category.Color), cp+".color", "%q is not a hex color (#rgb or #rrggbb)", category.Color)
+		if err := validateFilterConfig(category.Filters); err != nil {
+			v.errorf(cp+".filters", "%v", err)
+		}
+
+		for j, source := range category.Sources {
+			sp := fmt.Sprintf("%s.sources[%d]", cp, j)
+			v.check(strings.TrimSpace(source.Name) != "", sp+".name", "must not be empty")
+			v.check(validHTTPURL(source.URL), sp+".url", "%q is not an http(s) URL", source.URL)
+			v.check(source.Site == "" || validHTTPURL(source.Site), sp+".siteUrl", "%q is not an http(s) URL", source.Site)
+			if err := validateFilterConfig(source.Filters); err != nil {
+				v.errorf(sp+".filters", "%v", err)
+			}
+
+			id := SourceID(category.Category, source.Name)
+			if other, ok := sourcePaths[id]; ok {
+				v.errorf(sp+".name", "source %q in category %q clashes with %s (same source ID %q)", source.Name, category.Category, other, id)
+				continue
+			}
+			sourcePaths[id] = sp
+		}
+	}
+
+	r := cfg.Refresh
+	v.check(r.IntervalMinutes >= 1, "refresh.intervalMinutes", "must be at least 1, got %d", r.IntervalMinutes)
+	v.check(r.NotModifiedBackoffMultiplier >= 1, "refresh.notModifiedBackoffMultiplier", "must be at least 1, got %g", r.NotModifiedBackoffMultiplier)
+	v.check(r.MaxIntervalMinutes >= r.IntervalMinutes, "refresh.maxIntervalMinutes", "must not be below intervalMinutes (%d), got %d", r.IntervalMinutes, r.MaxIntervalMinutes)
+	v.check(r.HistoryRetentionDays >= 1, "refresh.historyRetentionDays", "must be at least 1, got %d", r.HistoryRetentionDays)
+
+	ml := cfg.ML
+	v.check(ml.MaxItemAgeHours >= 1, "ml.maxItemAgeHours", "must be at least 1, got %d", ml.MaxItemAgeHours)
+	v.check(ml.ClickWeight > 0, "ml.clickWeight", "must be positive, got %g", ml.ClickWeight)
+	v.check(ml.TokenDecayPerDay >= 0 && ml.TokenDecayPerDay <= 1, "ml.tokenDecayPerDay", "must be between 0 and 1, got %g", ml.TokenDecayPerDay)
+	v.check(ml.RetentionDays >= 1, "ml.retentionDays", "must be at least 1, got %d", ml.RetentionDays)
+	v.nonNegative("ml.backup.intervalHours", ml.Backup.IntervalHours)
+	v.nonNegative("ml.backup.keep", ml.Backup.Keep)
+
+	a := cfg.Auth
+	v.nonNegative("auth.maxAgeSeconds", a.MaxAgeSeconds)
+	v.nonNegative("auth.maxFutureSeconds", a.MaxFutureSeconds)
+	v.nonNegative("auth.nonceCacheSize", a.NonceCacheSize)
+	v.nonNegative("auth.sessionTTLMinutes", a.SessionTTLMinutes)
+
+	return errors.Join(v.errs...)
+}
+
+// combineFeedCategories merges categories listed more than once (matched
+// case-insensitively); the first entry's color and filters win
+func combineFeedCategories(feeds []FeedCategory) []FeedCategory {
+	var out []FeedCategory
+	for _, category := range feeds {
+		i := slices.IndexFunc(out, func(c FeedCategory) bool { return strings.EqualFold(c.Category, category.Category) })
+		if i < 0 {
+			category.Sources = slices.Clone(category.Sources)
+			out = append(out, category)
+			continue
+		}
+		out[i].Sources = append(out[i].Sources, category.Sources...)
+	}
+	return out
+}
+
+// ValidateConfigFile loads a config file with its fragments and overrides
+// and returns every problem found, one error per line
+func ValidateConfigFile(path string) error {
+	_, err := parseConfigFile(path)
+	return err
+}
@@ -0,0 +1,184 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestConfigSourcePosition(t *testing.T) {
+	parse := func(doc string) *yaml.Node {
+		var n yaml.Node
+		if err := yaml.Unmarshal([]byte(doc), &n); err != nil {
+			t.Fatal(err)
+		}
+		return n.Content[0]
+	}
+	root := parse(`server:
+  port: 8080
+feeds:
+  - category: News
+    sources:
+      - name: Example
+        url: https://example.com/rss
+`)
+	fragment := parse(`feeds:
+  - category: Tech
+    sources:
+      - name: Go
+        url: feed.xml
+`)
+	src := &configSource{files: map[*yaml.Node]string{}, env: []string{"DASHBOARD_ML_RETENTIONDAYS"}}
+	src.add("config.yaml", root)
+	src.add("config.d/tech.yaml", fragment)
+	src.root = root
+	mergeConfigNodes(src.root, fragment)
+
+	for path, want := range map[string]string{
+		"server.port":              "config.yaml:2",
+		"feeds[0].sources[0].url":  "config.yaml:7",
+		"feeds[1].sources[0].url":  "config.d/tech.yaml:5",
+		"feeds[1].category":        "config.d/tech.yaml:2",
+		"feeds[0].sources[3].name": "config.yaml:5",
+		"server.basePath":          "config.yaml:1",
+		"refresh.intervalMinutes":  "",
+		"ml.retentionDays":         "DASHBOARD_ML_RETENTIONDAYS",
+	} {
+		if got := src.position(path); got != want {
+			t.Errorf("position(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		fragment string
+		env      map[string]string
+		want     []string // expected error lines, none for a valid config
+	}{
+		{
+			name: "valid",
+			config: `feeds:
+  - category: News
+    color: "#abc"
+    sources:
+      - name: Example
+        url: https://example.com/rss
+`,
+		},
+		{
+			name: "non-ASCII and symbol-only names",
+			config: `feeds:
+  - category: Новости
+    sources:
+      - name: Медуза
+        url: https://meduza.example/rss
+      - name: Дождь
+        url: https://tvrain.example/rss
+      - name: "+++"
+        url: https://plus.example/rss
+      - name: "***"
+        url: https://star.example/rss
+`,
+		},
+		{
+			name: "every problem with its line",
+			config: `server:
+  port: 70000
+  publicURL: "example.com"
+feeds:
+  - category: News
+    color: red
+    sources:
+      - name: Example
+        url: ftp://example.com/rss
+ml:
+  tokenDecayPerDay: 2
+`,
+			want: []string{
+				`config.yaml:2: server.port: must be between 1 and 65535, got 70000`,
+				`config.yaml:3: server.publicURL: must be an http(s) URL without query or fragment, got "example.com"`,
+				`config.yaml:6: feeds[0].color: "red" is not a hex color (#rgb or #rrggbb)`,
+				`config.yaml:9: feeds[0].sources[0].url: "ftp://example.com/rss" is not an http(s) URL`,
+				`config.yaml:11: ml.tokenDecayPerDay: must be between 0 and 1, got 2`,
+			},
+		},
+		{
+			name: "source ID clash across a fragment",
+			config: `feeds:
+  - category: News
+    sources:
+      - name: Foo Bar
+        url: https://foo.example/rss
+`,
+			fragment: `feeds:
+  - category: news
+    sources:
+      - name: foo-bar
+        url: https://bar.example/rss
+`,
+			want: []string{
+				`config.d/tech.yaml:4: feeds[1].sources[0].name: source "foo-bar" in category "news" clashes with feeds[0].sources[0] (same source ID "news--foo-bar")`,
+			},
+		},
+		{
+			name: "authentication cannot be disabled on admin routes",
+			config: `server:
+  limits:
+    routes:
+      "GET /api/ml/export":
+        requireHMAC: false
+      "GET /api/feeds/top":
+        requireHMAC: true
+`,
+			want: []string{
+				`config.yaml:2: server.limits: route GET /api/ml/export: requireHMAC cannot be disabled, the route needs an authenticated user`,
+			},
+		},
+		{
+			name:   "environment override",
+			config: "feeds: []\n",
+			env:    map[string]string{"DASHBOARD_REFRESH_INTERVALMINUTES": "-5"},
+			want: []string{
+				`DASHBOARD_REFRESH_INTERVALMINUTES: refresh.intervalMinutes: must be at least 1, got -5`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if tt.fragment != "" {
+				if err := os.Mkdir(filepath.Join(dir, "config.d"), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "config.d", "tech.yaml"), []byte(tt.fragment), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := parseConfigFile(path)
+			var got []string
+			if err != nil {
+				for _, line := range strings.Split(err.Error(), "\n") {
+					got = append(got, strings.TrimPrefix(line, dir+string(filepath.Separator)))
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
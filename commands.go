@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"dashboard/backend"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, `Usage: %s [flags] [command] [arguments]
+
+Commands:
+  serve                      run the server (default)
+  validate-config            check the configuration and print all problems
+  fetch <source>             fetch one source and print its items
+                             (source ID, category:name or name)
+  import-opml <file>         merge an OPML file into the config file
+  ml export [-user id] [-format json|ndjson] [file]
+                             write weights, clicks and model settings
+  ml import [-mode replace|merge] [-as id] [-create-users] <file>
+                             load an export into the users it contains
+                             (unknown users are refused unless -create-users)
+  ml reset (-user id | -all) delete learned weights and click history
+  ml retrain [-user id]      rebuild token weights from the click history
+  db migrate                 apply pending schema migrations
+  db vacuum                  compact the database file
+  db backup [file]           write a consistent copy of the database
+                             (default: into ml.backup.dir, with rotation)
+  db restore <file>          check a backup and replace the database with it
+                             (refused while the server has the database open)
+  sign [-key id] [-secret-file file|-] [-content-type t] [-v1] <method> <path> [body|@file|-]
+                             print an X-HMAC-Signature header value; the secret
+                             comes from $DASHBOARD_HMAC_SECRET or -secret-file,
+                             never from the command line
+
+The ml and db commands write to the database; restart a running server
+afterwards so it picks up the changes.
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+// loadConfig loads the configuration or exits
+func loadConfig() {
+	if err := backend.LoadConfig(); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+}
+
+// openStore opens the database configured in ml.dbPath or exits
+func openStore() {
+	dbPath := backend.Cfg.ML.DBPath
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		log.Fatalf("Failed to create data directory: %v", err)
+	}
+	if err := backend.OpenStore(dbPath); err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+}
+
+// openInput opens a file argument, "-" meaning stdin
+func openInput(name string) io.ReadCloser {
+	if name == "-" {
+		return io.NopCloser(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", name, err)
+	}
+	return f
+}
+
+// validateConfig checks the config file (with config.d fragments and
+// environment overrides) and prints every problem with its location
+func validateConfig() {
+	if err := backend.ValidateConfigFile(backend.ConfigPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: OK\n", backend.ConfigPath)
+}
+
+// importOPML merges an OPML file into the config file without starting the server
+func importOPML(args []string) {
+	if len(args) != 1 {
+		log.Fatalf("Usage: %s import-opml <file.opml>", os.Args[0])
+	}
+	loadConfig()
+
+	f := openInput(args[0])
+	defer f.Close()
+
+	backend.InitFeedCache()
+	result, err := backend.ImportOPML(f)
+	if err != nil {
+		log.Fatalf("OPML import failed: %v", err)
+	}
+
+	for _, name := range result.Added {
+		fmt.Printf("added     %s\n", name)
+	}
+	for _, url := range result.Duplicates {
+		fmt.Printf("duplicate %s\n", url)
+	}
+	for _, url := range result.Invalid {
+		fmt.Printf("invalid   %s\n", url)
+	}
+	fmt.Printf("%d added, %d duplicates, %d invalid, %d new categories\n", len(result.Added), len(result.Duplicates), len(result.Invalid), len(result.Categories))
+}
+
+// fetchSource fetches a single source once, with filters applied, and
+// prints the parsed items
+func fetchSource(args []string) {
+	if len(args) != 1 {
+		log.Fatalf("Usage: %s fetch <source>", os.Args[0])
+	}
+	loadConfig()
+	backend.InitFeedCache()
+
+	source, category, err := backend.LookupSource(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	backend.FeedCacheMu.Lock()
+	entry, err := backend.FetchFeed(ctx, source, category)
+	backend.FeedCacheMu.Unlock()
+	if err != nil {
+		log.Fatalf("Fetching %s failed: %v", source.URL, err)
+	}
+
+	for _, item := range entry.Items {
+		fmt.Printf("%s  %s\n", item.PublishedAt.Local().Format("2006-01-02 15:04"), item.Title)
+		fmt.Printf("                  %s\n", item.Link)
+	}
+	fmt.Printf("%d items from %s:%s (%s), %d filtered\n", len(entry.Items), category, source.Name, source.URL, entry.Filtered)
+}
+
+// mlCommand manages the learned preferences: export, import, reset, retrain
+func mlCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: %s ml export|import|reset|retrain", os.Args[0])
+	}
+	fs := flag.NewFlagSet("ml "+args[0], flag.ExitOnError)
+	user := fs.String("user", "", "limit to this user ID (default all users)")
+	all := fs.Bool("all", false, "reset: confirm deleting the preferences of all users")
+	format := fs.String("format", "json", "export: json or ndjson (one record per line)")
+	mode := fs.String("mode", backend.ImportReplace, "import: replace the users' preferences or merge into them")
+	as := fs.String("as", "", "import: load a single-user export into this user instead")
+	createUsers := fs.Bool("create-users", false, "import: create profiles for users that do not exist yet")
+	fs.Parse(args[1:])
+
+	loadConfig()
+	openStore()
+	defer backend.CloseStore()
+
+	switch args[0] {
+	case "export":
+		if *format != "json" && *format != "ndjson" {
+			log.Fatalf("Unsupported format %q (expected json or ndjson)", *format)
+		}
+		out := os.Stdout
+		if fs.NArg() > 0 && fs.Arg(0) != "-" {
+			f, err := os.Create(fs.Arg(0))
+			if err != nil {
+				log.Fatalf("Failed to create %s: %v", fs.Arg(0), err)
+			}
+			defer f.Close()
+			out = f
+		}
+		if err := backend.ExportPreferences(out, *user, *format == "ndjson"); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+
+	case "import":
+		if fs.NArg() != 1 {
+			log.Fatalf("Usage: %s ml import <file|->", os.Args[0])
+		}
+		// The import checks the users it names against the stored profiles
+		if err := backend.LoadUsers(); err != nil {
+			log.Fatalf("Failed to load users: %v", err)
+		}
+		in := openInput(fs.Arg(0))
+		defer in.Close()
+		result, err := backend.ImportPreferences(in, backend.ImportOptions{Mode: *mode, AsUser: *as, CreateUsers: *createUsers})
+		if err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		for _, userID := range result.CreatedUsers {
+			fmt.Printf("created user %s (map a keyring key to it to sign as this user)\n", userID)
+		}
+		for _, setting := range result.SettingsDiffer {
+			fmt.Printf("note: exported with %s\n", setting)
+		}
+		fmt.Printf("imported %d token weights and %d click events for %s (%d duplicate clicks skipped)\n",
+			result.TokenWeights, result.ClickEvents, strings.Join(result.Users, ", "), result.SkippedClickEvents)
+
+	case "reset":
+		if *user == "" && !*all {
+			log.Fatalf("Usage: %s ml reset -user <id> | -all", os.Args[0])
+		}
+		weights, events, err := backend.ResetPreferences(*user)
+		if err != nil {
+			log.Fatalf("Reset failed: %v", err)
+		}
+		fmt.Printf("deleted %d token weights and %d click events\n", weights, events)
+
+	case "retrain":
+		clicks, err := backend.RetrainTokenWeights(*user)
+		if err != nil {
+			log.Fatalf("Retrain failed: %v", err)
+		}
+		fmt.Printf("rebuilt token weights from %d clicks\n", clicks)
+
+	default:
+		log.Fatalf("Unknown ml command %q (expected export, import, reset or retrain)", args[0])
+	}
+}
+
+// dbCommand runs database maintenance: migrate, vacuum, backup, restore
+func dbCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: %s db migrate|vacuum|backup|restore", os.Args[0])
+	}
+	loadConfig()
+	if args[0] == "restore" {
+		restoreStore(args[1:])
+		return
+	}
+	// Opening the store applies pending migrations
+	openStore()
+	defer backend.CloseStore()
+
+	switch args[0] {
+	case "migrate":
+		current, latest, err := backend.SchemaVersion()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s: schema version %d (latest %d)\n", backend.Cfg.ML.DBPath, current, latest)
+
+	case "vacuum":
+		if err := backend.VacuumStore(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s: vacuumed\n", backend.Cfg.ML.DBPath)
+
+	case "backup":
+		if len(args) > 2 {
+			log.Fatalf("Usage: %s db backup [file]", os.Args[0])
+		}
+		var path string
+		var err error
+		if len(args) == 2 {
+			path = args[1]
+			err = backend.BackupStore(path)
+		} else {
+			path, err = backend.ScheduledBackup()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("backed up %s to %s\n", backend.Cfg.ML.DBPath, path)
+
+	default:
+		log.Fatalf("Unknown db command %q (expected migrate, vacuum, backup or restore)", args[0])
+	}
+}
+
+// restoreStore replaces the database with a backup. The current database is
+// moved aside without being opened, so this also works when it is damaged.
+func restoreStore(args []string) {
+	if len(args) != 1 {
+		log.Fatalf("Usage: %s db restore <file>", os.Args[0])
+	}
+	dbPath := backend.Cfg.ML.DBPath
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		log.Fatalf("Failed to create data directory: %v", err)
+	}
+
+	previous, err := backend.RestoreStore(dbPath, args[0])
+	if previous != "" {
+		fmt.Printf("previous database moved to %s\n", previous)
+	}
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	defer backend.CloseStore()
+
+	current, _, err := backend.SchemaVersion()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("restored %s from %s (schema version %d)\n", dbPath, args[0], current)
+}
+
+// signRequest prints an X-HMAC-Signature header value for scripting, e.g.
+//
+//	curl -H "X-HMAC-Signature: $(dashboard sign GET /api/dashboard)" ...
+func signRequest(args []string) {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	keyID := fs.String("key", backend.DefaultKeyID, "key ID (or user ID) the secret belongs to")
+	secretFile := fs.String("secret-file", "", "read the HMAC secret from this file, - for stdin (default $DASHBOARD_HMAC_SECRET)")
+	contentType := fs.String("content-type", "", "Content-Type of the request, covered by v2 signatures")
+	legacy := fs.Bool("v1", false, "produce a legacy v1 signature")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 || fs.NArg() > 3 {
+		log.Fatalf("Usage: %s sign [-key id] [-secret-file file|-] [-content-type t] [-v1] <method> <path> [body|@file|-]", os.Args[0])
+	}
+
+	// Secrets on the command line end up in shell history and process lists
+	secret := os.Getenv("DASHBOARD_HMAC_SECRET")
+	if *secretFile != "" {
+		if *secretFile == "-" && (fs.Arg(2) == "-" || fs.Arg(2) == "@-") {
+			log.Fatal("The secret and the body cannot both be read from stdin")
+		}
+		in := openInput(*secretFile)
+		raw, err := io.ReadAll(in)
+		in.Close()
+		if err != nil {
+			log.Fatalf("Failed to read secret: %v", err)
+		}
+		secret = strings.TrimRight(string(raw), "\r\n")
+	}
+	if secret == "" {
+		log.Fatal("No secret: set DASHBOARD_HMAC_SECRET or pass -secret-file")
+	}
+
+	method := strings.ToUpper(fs.Arg(0))
+	target, err := url.Parse(fs.Arg(1))
+	if err != nil {
+		log.Fatalf("Invalid path %q: %v", fs.Arg(1), err)
+	}
+
+	var body []byte
+	if fs.NArg() == 3 {
+		switch raw := fs.Arg(2); {
+		case raw == "-" || strings.HasPrefix(raw, "@"):
+			in := openInput(strings.TrimPrefix(raw, "@"))
+			body, err = io.ReadAll(in)
+			in.Close()
+			if err != nil {
+				log.Fatalf("Failed to read body: %v", err)
+			}
+		default:
+			body = []byte(raw)
+		}
+	}
+
+	if *legacy {
+		nonce, err := backend.NewNonce()
+		if err != nil {
+			log.Fatal(err)
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		signature := backend.ComputeSignature(secret, method, target.Path, timestamp, nonce, string(body))
+		fmt.Printf("%s:%s:%s:%s\n", *keyID, timestamp, nonce, signature)
+		return
+	}
+
+	header := http.Header{}
+	if *contentType != "" {
+		header.Set("Content-Type", *contentType)
+	}
+	value, err := backend.SignatureHeaderV2(*keyID, secret, method, target.Path, target.Query(), header, body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(value)
+}
@@ -1,10 +1,14 @@
     // Configuration
-    const API_BASE = window.location.origin;
+    // Dashboard root including the server's basePath (from the injected <base>)
+    const API_BASE = new URL(document.baseURI).href.replace(/\/$/, '');
     const TOP_HITS_LIMIT = 3;
     const FEED_COUNT_KEY = 'feedItemCounts';
     const FEED_ORDER_KEY = 'feedOrder';
+    const LOAD_MORE_STEP = 10;
     const versionBadge = document.getElementById('versionBadge');
     let lastDashboardData = null;
+    // Older items fetched from /api/sources/{id}/items, keyed by feed key
+    const sourceHistory = {};
 
     function renderVersionBadge(version) {
       if (!versionBadge) return;
@@ -38,6 +42,21 @@
       return Number.isFinite(val) && val > 0 ? val : 10;
     }
 
+    // Selected item count plus any items revealed with "Load more"
+    function getVisibleCount(feedKey) {
+      const history = sourceHistory[feedKey];
+      return getFeedCount(feedKey) + (history ? history.extra : 0);
+    }
+
+    // Cached items followed by older history items not already present
+    function itemsWithHistory(group, feedKey) {
+      const items = group.items || [];
+      const history = sourceHistory[feedKey];
+      if (!history) return items;
+      const seen = new Set(items.map(item => item.link));
+      return items.concat(history.items.filter(item => !seen.has(item.link)));
+    }
+
     function setFeedCount(feedKey, count) {
       const prefs = loadFeedCountPrefs();
       prefs[feedKey] = count;
@@ -115,7 +134,7 @@
     }
 
     // Render feed card
-    function renderFeedCard(feedKey, categoryName, categoryColor, items, siteUrl, itemCount, isMobile = false, topRatedMap = {}) {
+    function renderFeedCard(feedKey, categoryName, categoryColor, items, siteUrl, itemCount, isMobile = false, topRatedMap = {}, sourceId = '') {
       const feedItems = items
         .slice(0, itemCount)
         .map(item => {
@@ -137,9 +156,14 @@
         .join('');
 
       const draggableAttr = isMobile ? '' : ' draggable="true"';
+      const history = sourceHistory[feedKey];
+      const canLoadMore = sourceId && items.length > 0 && (items.length > itemCount || !(history && history.done));
+      const loadMore = canLoadMore
+        ? `<li class="load-more"><button class="load-more-btn" data-feed-key="${feedKey}" data-source-id="${sourceId}">Load more</button></li>`
+        : '';
 
       return `
-          <div class="card feed-card" style="--accent: ${categoryColor}" data-feed-name="${feedKey}" data-column="0">
+          <div class="card feed-card" data-accent="${categoryColor}" data-feed-name="${feedKey}" data-column="0">
           <div class="feed-topline"></div>
           <div class="feed-titlebar"${draggableAttr}>
         <div>
@@ -153,14 +177,22 @@
       </div>
       <ul class="card-content">
         ${feedItems || '<li class="loading">Loading feed...</li>'}
+        ${feedItems ? loadMore : ''}
       </ul>
     </div>
   `;
     }
 
+    // CSRF token of the current login session (null when not logged in)
+    function getCsrfToken() {
+      const match = document.cookie.match(/(?:^|;\s*)dashboard_csrf=([^;]+)/);
+      return match ? decodeURIComponent(match[1]) : null;
+    }
+
     function sendFeedback(title, link) {
       const secret = localStorage.getItem('dashboardHmacSecret');
-      if (!secret) return;
+      const csrfToken = getCsrfToken();
+      if (!secret && !csrfToken) return;
 
       const body = JSON.stringify({
         itemTitle: title,
@@ -170,8 +202,13 @@
 
       (async () => {
         const headers = { 'Content-Type': 'application/json' };
-        const sig = await signRequest('POST', '/api/feedback', body);
-        if (sig) headers['X-HMAC-Signature'] = sig;
+        if (secret) {
+          const sig = await signRequest('POST', '/api/feedback', body, headers['Content-Type']);
+          if (sig) headers['X-HMAC-Signature'] = sig;
+        } else {
+          // Session cookie is sent automatically; echo the CSRF token
+          headers['X-CSRF-Token'] = csrfToken;
+        }
 
         fetch(`${API_BASE}/api/feedback`, {
           method: 'POST',
@@ -201,6 +238,38 @@
     }
 
     // Handle feed count changes
+    // Reveal more items of a feed, fetching older ones from the item history
+    async function loadMoreItems(feedKey, sourceId) {
+      const group = (lastDashboardData?.feeds || []).find(g => (g.source || g.category || 'Feed') === feedKey);
+      if (!group) return;
+
+      const history = sourceHistory[feedKey] || (sourceHistory[feedKey] = { items: [], cursor: '', done: false, extra: 0 });
+      const wanted = getVisibleCount(feedKey) + LOAD_MORE_STEP;
+
+      while (!history.done && itemsWithHistory(group, feedKey).length < wanted) {
+        const cursor = history.cursor ? `&cursor=${encodeURIComponent(history.cursor)}` : '';
+        const response = await fetch(`${API_BASE}/api/sources/${encodeURIComponent(sourceId)}/items?limit=${LOAD_MORE_STEP * 2}${cursor}`);
+        if (!response.ok) throw new Error(`HTTP ${response.status}`);
+        const data = await response.json();
+        history.items.push(...(data.items || []));
+        history.cursor = data.nextCursor || '';
+        history.done = !data.nextCursor;
+      }
+
+      history.extra += LOAD_MORE_STEP;
+      renderLayout(lastDashboardData);
+    }
+
+    function handleLoadMore(event) {
+      const button = event.target.closest('.load-more-btn');
+      if (!button) return;
+      button.disabled = true;
+      loadMoreItems(button.getAttribute('data-feed-key'), button.getAttribute('data-source-id')).catch(error => {
+        console.error('Failed to load more items:', error);
+        button.disabled = false;
+      });
+    }
+
     function handleFeedCountChange(event) {
       const select = event.target.closest('.feed-count-select');
       if (!select) return;
@@ -344,8 +413,8 @@
       const allVisibleLinks = new Set();
       for (const group of feedGroups) {
         const feedKey = group.source || group.category || 'Feed';
-        const itemCount = getFeedCount(feedKey);
-        const items = group.items || [];
+        const itemCount = getVisibleCount(feedKey);
+        const items = itemsWithHistory(group, feedKey);
         for (let i = 0; i < itemCount && i < items.length; i++) {
           if (items[i].link) allVisibleLinks.add(items[i].link);
         }
@@ -385,12 +454,12 @@
         if (columns[colIndex]) {
           for (const item of columns[colIndex]) {
             const group = item.group;
-            const items = group.items || [];
             const name = group.source || group.category || 'Feed';
             const color = group.color || '#4ba6cd';
             const feedKey = group.source || name;
-            const itemCount = getFeedCount(feedKey);
-            const feedHtml = renderFeedCard(feedKey, name, color, items, group.siteUrl, itemCount, isMobile, topRatedMap);
+            const items = itemsWithHistory(group, feedKey);
+            const itemCount = getVisibleCount(feedKey);
+            const feedHtml = renderFeedCard(feedKey, name, color, items, group.siteUrl, itemCount, isMobile, topRatedMap, group.id);
             const feedWithCol = feedHtml.replace(/data-column="0"/, `data-column="${colIndex}"`);
             html += feedWithCol;
           }
@@ -408,12 +477,22 @@
       }
 
       layout.innerHTML = html;
+
+      // The CSP blocks inline style attributes; set accents through the CSSOM
+      layout.querySelectorAll('.feed-card[data-accent]').forEach(card => {
+        card.style.setProperty('--accent', card.dataset.accent);
+      });
     }
 
     // Main render function (fetch + render)
     async function renderDashboard() {
       try {
-        const response = await fetch(`${API_BASE}/api/dashboard`);
+        // Signed requests get the signing user's personal top-rated list
+        const headers = {};
+        const sig = await signRequest('GET', '/api/dashboard');
+        if (sig) headers['X-HMAC-Signature'] = sig;
+
+        const response = await fetch(`${API_BASE}/api/dashboard`, { headers });
         if (!response.ok) throw new Error(`HTTP ${response.status}`);
 
         const data = await response.json();
@@ -438,7 +517,7 @@
         errorOverlay.innerHTML = `
           <div class="error-overlay-header">
             <div class="error-overlay-title">⚠️ Failed to refresh dashboard</div>
-            <button class="error-overlay-close" onclick="this.parentElement.parentElement.remove()">×</button>
+            <button class="error-overlay-close">×</button>
           </div>
           <div class="error-overlay-content">
             <strong>${error.message}</strong><br/>
@@ -453,6 +532,7 @@
             ` : ''}
           </div>
         `;
+        errorOverlay.querySelector('.error-overlay-close').addEventListener('click', () => errorOverlay.remove());
         document.body.appendChild(errorOverlay);
         
         // Auto-dismiss after 10 seconds if there's cached data
@@ -468,6 +548,7 @@
 
     // Event listeners (set once)
     layout.addEventListener('click', trackClick);
+    layout.addEventListener('click', handleLoadMore);
     layout.addEventListener('auxclick', trackAuxClick);
     layout.addEventListener('change', handleFeedCountChange);
     layout.addEventListener('dragstart', handleFeedDragStart);
@@ -492,8 +573,10 @@
     // Settings panel (Ctrl+Shift+S)
     const settingsPanel = document.getElementById('settingsPanel');
     const hmacInput = document.getElementById('hmacInput');
+    const userInput = document.getElementById('userInput');
     const settingsStatus = document.getElementById('settingsStatus');
     const saveBtnSettings = document.getElementById('saveBtnSettings');
+    const loginBtnSettings = document.getElementById('loginBtnSettings');
     const clearBtnSettings = document.getElementById('clearBtnSettings');
     const closeBtnSettings = document.getElementById('closeBtnSettings');
 
@@ -501,6 +584,7 @@
     if (hmacSecret) {
       hmacInput.value = hmacSecret;
     }
+    userInput.value = localStorage.getItem('dashboardKeyId') || '';
 
     document.getElementById('settingsGear').addEventListener('click', () => {
       settingsPanel.classList.toggle('visible');
@@ -516,6 +600,12 @@
         return;
       }
       localStorage.setItem('dashboardHmacSecret', secret);
+      const keyId = userInput.value.trim();
+      if (keyId) {
+        localStorage.setItem('dashboardKeyId', keyId);
+      } else {
+        localStorage.removeItem('dashboardKeyId');
+      }
       settingsStatus.textContent = '✓ HMAC secret saved';
       settingsStatus.style.color = '#9ee7ff';
       setTimeout(() => {
@@ -523,10 +613,46 @@
       }, 2000);
     });
 
-    // Clear HMAC secret
+    // Log in: exchange the secret for a session cookie instead of storing it
+    loginBtnSettings.addEventListener('click', async () => {
+      const secret = hmacInput.value.trim();
+      if (!secret) {
+        settingsStatus.textContent = '❌ Secret cannot be empty';
+        settingsStatus.style.color = '#ff6b6b';
+        return;
+      }
+      try {
+        const response = await fetch(`${API_BASE}/api/login`, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ keyId: userInput.value.trim(), secret }),
+        });
+        if (!response.ok) throw new Error(`HTTP ${response.status}`);
+        const data = await response.json();
+
+        // The session replaces the stored secret
+        localStorage.removeItem('dashboardHmacSecret');
+        localStorage.removeItem('dashboardKeyId');
+        hmacInput.value = '';
+        settingsStatus.textContent = `✓ Logged in as ${data.user}`;
+        settingsStatus.style.color = '#9ee7ff';
+        renderDashboard();
+      } catch (e) {
+        settingsStatus.textContent = `❌ Login failed (${e.message})`;
+        settingsStatus.style.color = '#ff6b6b';
+      }
+      setTimeout(() => {
+        settingsStatus.textContent = '';
+      }, 2000);
+    });
+
+    // Clear HMAC secret and log out
     clearBtnSettings.addEventListener('click', () => {
       localStorage.removeItem('dashboardHmacSecret');
+      localStorage.removeItem('dashboardKeyId');
       hmacInput.value = '';
+      userInput.value = '';
+      fetch(`${API_BASE}/api/logout`, { method: 'POST' }).catch(() => {});
       settingsStatus.textContent = '✓ HMAC secret cleared';
       settingsStatus.style.color = '#9ee7ff';
       setTimeout(() => {
@@ -546,19 +672,53 @@
       }
     });
     
-    async function signRequest(method, path, body = '') {
+    // Canonical query string as built by CanonicalQuery in backend/signing.go: keys and then
+    // values sorted by their UTF-8 bytes, encoded like Go's url.QueryEscape (space as '+')
+    function canonicalQuery(query) {
+      const encoder = new TextEncoder();
+      const compare = (a, b) => {
+        const x = encoder.encode(a), y = encoder.encode(b);
+        for (let i = 0; i < Math.min(x.length, y.length); i++) {
+          if (x[i] !== y[i]) return x[i] - y[i];
+        }
+        return x.length - y.length;
+      };
+      const escape = s => encodeURIComponent(s)
+        .replace(/[!'()*]/g, c => '%' + c.charCodeAt(0).toString(16).toUpperCase())
+        .replace(/%20/g, '+');
+
+      const params = new URLSearchParams(query);
+      const parts = [];
+      for (const key of [...new Set(params.keys())].sort(compare)) {
+        for (const value of params.getAll(key).sort(compare)) {
+          parts.push(`${escape(key)}=${escape(value)}`);
+        }
+      }
+      return parts.join('&');
+    }
+
+    // Signs a request with the v2 canonical format (see CanonicalRequestV2 in backend/signing.go):
+    // method, path, sorted query, signed headers, timestamp, nonce and body hash, one per line.
+    // query is what the request URL carries after '?', as a string, object or URLSearchParams.
+    async function signRequest(method, path, body = '', contentType = '', query = '') {
       const secret = localStorage.getItem('dashboardHmacSecret'); // Re-read from localStorage
       if (!secret) return null;
       
+      const toHex = buf => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, '0')).join('');
+      const encoder = new TextEncoder();
+
       const timestamp = Math.floor(Date.now() / 1000);
-      const payload = `${method}|${path}|${timestamp}|${body}`;
+      // Single-use nonce so a captured request cannot be replayed
+      const nonce = toHex(crypto.getRandomValues(new Uint8Array(16)));
+      const bodyHash = toHex(await crypto.subtle.digest('SHA-256', encoder.encode(body)));
+      const payload = ['DASHBOARD-HMAC-V2', method, path, canonicalQuery(query), `content-type:${contentType}`, timestamp, nonce, bodyHash].join('\n');
       
-      const encoder = new TextEncoder();
       const key = await crypto.subtle.importKey('raw', encoder.encode(secret), { name: 'HMAC', hash: 'SHA-256' }, false, ['sign']);
       const signature = await crypto.subtle.sign('HMAC', key, encoder.encode(payload));
-      const hexSig = Array.from(new Uint8Array(signature)).map(b => b.toString(16).padStart(2, '0')).join('');
-      
-      return `${timestamp}:${hexSig}`;
+
+      // The master secret is the "default" key
+      const keyId = localStorage.getItem('dashboardKeyId') || 'default';
+      return `v2:${keyId}:${timestamp}:${nonce}:${toHex(signature)}`;
     }
 
     // Initial load and auto-refresh every 5 minutes
@@ -3,6 +3,7 @@ module dashboard
 go 1.25.0
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/mmcdole/gofeed v1.3.0
 	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.46.2
@@ -3,43 +3,101 @@ package main
 import (
 	"context"
 	"dashboard/backend"
+	"embed"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 )
 
+// Frontend assets are compiled into the binary; -frontend-dir serves them
+// from disk instead while developing
+//
+//go:embed frontend
+var embeddedFrontend embed.FS
+
 func main() {
+	frontendDir := flag.String("frontend-dir", "", "serve frontend assets from this directory instead of the embedded copy (development)")
+	if path := os.Getenv(backend.ConfigEnvVar); path != "" {
+		backend.ConfigPath = path
+	}
+	flag.StringVar(&backend.ConfigPath, "config", backend.ConfigPath, "configuration file; config.d/*.yaml next to it is merged in (env "+backend.ConfigEnvVar+")")
+	flag.Usage = usage
+	flag.Parse()
+
 	backend.AppVersion = os.Getenv("DASHBOARD_VERSION")
 
-	// Load configuration
-	if err := backend.LoadConfig(); err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+	command, args := "serve", []string{}
+	if flag.NArg() > 0 {
+		command, args = flag.Arg(0), flag.Args()[1:]
 	}
 
-	// Initialize HMAC authentication
-	backend.InitHMAC("")
+	switch command {
+	case "serve":
+		serve(*frontendDir)
+	case "validate-config", "validate":
+		validateConfig()
+	case "fetch":
+		fetchSource(args)
+	case "import-opml":
+		importOPML(args)
+	case "ml":
+		mlCommand(args)
+	case "db":
+		dbCommand(args)
+	case "sign":
+		signRequest(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		usage()
+		os.Exit(2)
+	}
+}
+
+// serve runs the HTTP server until it fails
+func serve(frontendDir string) {
+	loadConfig()
 
 	// Initialize caches
 	backend.InitFeedCache()
 
-	// Initialize SQLite store for ML persistence
-	dbPath := backend.Cfg.ML.DBPath
-	if dbPath == "" {
-		dbPath = "data/ml_preferences.db"
+	frontendFS, err := fs.Sub(embeddedFrontend, "frontend")
+	if err != nil {
+		log.Fatalf("Failed to open embedded frontend: %v", err)
 	}
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		log.Fatalf("Failed to create data directory: %v", err)
+	if frontendDir != "" {
+		frontendFS = os.DirFS(frontendDir)
+		log.Printf("Serving frontend from %s", frontendDir)
 	}
-	if err := backend.OpenStore(dbPath); err != nil {
-		log.Fatalf("Failed to open store: %v", err)
+	if err := backend.SetFrontend(frontendFS, frontendDir != ""); err != nil {
+		log.Fatalf("Failed to load frontend: %v", err)
 	}
+
+	// Initialize SQLite store for ML persistence
+	openStore()
 	defer backend.CloseStore()
 
 	if err := backend.PruneOldEvents(backend.Cfg.ML.RetentionDays); err != nil {
 		log.Printf("Warning: failed to prune old events: %v", err)
 	}
+	if err := backend.PruneOldItems(backend.Cfg.Refresh.HistoryRetentionDays); err != nil {
+		log.Printf("Warning: failed to prune old items: %v", err)
+	}
+	if err := backend.LoadUsers(); err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+
+	// Initialize HMAC authentication
+	if err := backend.InitHMAC(backend.Cfg.Auth.KeyringPath); err != nil {
+		log.Fatalf("Failed to initialize HMAC keyring: %v", err)
+	}
+	if err := backend.InitSessions(); err != nil {
+		log.Fatalf("Failed to initialize sessions: %v", err)
+	}
 	if err := backend.LoadTokenWeights(); err != nil {
 		log.Fatalf("Failed to load token weights: %v", err)
 	}
@@ -52,6 +110,11 @@ func main() {
 	defer cancel()
 
 	go backend.RefreshFeedsWorker(ctx)
+	go backend.WatchKeyring(ctx)
+	go backend.RateLimitJanitor(ctx)
+	go backend.PruneWorker(ctx)
+	go backend.WatchConfig(ctx)
+	go backend.BackupWorker(ctx)
 
 	// Initial feed fetch
 	for _, category := range backend.Cfg.Feeds {
@@ -70,28 +133,88 @@ func main() {
 	// Setup HTTP routes
 	mux := http.NewServeMux()
 
-	// API endpoints with rate limiting
-	// Read endpoints: 300 requests/minute per IP
-	// Write endpoints: 120 requests/minute per IP
+	// API endpoints with per-route rate limits, body size limits and auth
+	// requirements from server.limits (see backend/limits.go for defaults)
+	route := func(path string, handler http.Handler) {
+		mux.Handle(path, backend.RoutePolicyMiddleware(path, handler))
+	}
+
+	// Signed or logged-in dashboard requests get the user's top-rated list
+	route("/api/dashboard", http.HandlerFunc(backend.HandleDashboard))
+	// Aggregated output as RSS 2.0, Atom 1.0 or JSON Feed 1.1 (?format=rss|atom|json)
+	route("GET /api/feeds/category/{category}", http.HandlerFunc(backend.HandleCategoryFeed))
+	route("GET /api/feeds/source/{category}/{source}", http.HandlerFunc(backend.HandleSourceFeed))
+	route("GET /api/feeds/top", http.HandlerFunc(backend.HandleTopRatedFeed))
+	// Older items of a source from the persisted history ("load more")
+	route("GET /api/sources/{id}/items", http.HandlerFunc(backend.HandleSourceItems))
+	// Authenticated write endpoint (HMAC signature or session + CSRF token)
+	route("/api/feedback", http.HandlerFunc(backend.HandleClickFeedback))
+
+	// User management and HMAC key status/revocation (admin only)
+	route("/api/admin/users", backend.RequireAdmin(http.HandlerFunc(backend.HandleAdminUsers)))
+	route("/api/admin/keys", backend.RequireAdmin(http.HandlerFunc(backend.HandleAdminKeys)))
+	// Online database backup download (admin only, signed requests only: the
+	// copy holds every user's clicks and secrets)
+	route("GET /api/admin/backup", backend.RequireSignature(backend.RequireAdmin(http.HandlerFunc(backend.HandleBackupDownload))))
 
-	mux.Handle("/api/dashboard", backend.RateLimitMiddleware(http.HandlerFunc(backend.HandleDashboard), 300))
-	// HMAC-protected write endpoint (mandatory)
-	feedbackHandler := backend.RequireHMACAuth(
-		backend.MaxBodySizeMiddleware(http.HandlerFunc(backend.HandleClickFeedback), 1024*10),
-		true, // requireSecret=true: HMAC must be configured
-	)
-	feedbackHandler = backend.RateLimitMiddleware(feedbackHandler, 120)
-	mux.Handle("/api/feedback", feedbackHandler)
+	// Learned preferences as portable JSON: export (own profile, or any for
+	// admins) and import (admin only)
+	route("GET /api/ml/export", http.HandlerFunc(backend.HandleMLExport))
+	route("POST /api/ml/import", backend.RequireAdmin(http.HandlerFunc(backend.HandleMLImport)))
 
-	// Serve frontend
+	// OPML export (public) and import (admin only, persisted to the config file)
+	route("GET /api/opml", http.HandlerFunc(backend.HandleOPMLExport))
+	route("POST /api/opml", backend.RequireAdmin(http.HandlerFunc(backend.HandleOPMLImport)))
+
+	// Session login as an alternative to signing in the browser
+	route("/api/login", http.HandlerFunc(backend.HandleLogin))
+	route("/api/logout", http.HandlerFunc(backend.HandleLogout))
+	route("/api/session", http.HandlerFunc(backend.HandleSession))
+
+	// Content-Security-Policy violation reports (logged)
+	route("POST /api/csp-report", http.HandlerFunc(backend.HandleCSPReport))
+
+	// Serve frontend (embedded assets, SPA fallback for unknown paths)
 	mux.HandleFunc("/", backend.HandleFrontend)
-	// Apply CORS middleware
-	handler := backend.CORSMiddleware(mux)
+	// Apply security header, CORS and compression middleware, mounted under
+	// server.basePath
+	handler := backend.BasePathMiddleware(backend.SecurityHeadersMiddleware(backend.CORSMiddleware(backend.CompressionMiddleware(mux))))
 
 	// Start server
-	addr := fmt.Sprintf(":%d", backend.Cfg.Server.Port)
-	log.Printf("Starting server on %s", addr)
-	if err := http.ListenAndServe(addr, handler); err != nil {
+	serverCfg := backend.Cfg.Server
+	srv := backend.NewHTTPServer(serverCfg, handler)
+	ln, err := backend.Listen(serverCfg)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	if !serverCfg.TLS.Enabled() {
+		log.Printf("Starting server on %s", ln.Addr())
+		if err := srv.Serve(ln); err != nil {
+			log.Fatalf("Server error: %v", err)
+		}
+		return
+	}
+
+	reloader, err := backend.NewCertReloader(serverCfg.TLS.CertFile, serverCfg.TLS.KeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificate: %v", err)
+	}
+	go reloader.Watch(ctx)
+	srv.TLSConfig = backend.NewTLSConfig(reloader)
+
+	if serverCfg.TLS.RedirectHTTPPort > 0 {
+		redirect := backend.NewHTTPServer(serverCfg, backend.HTTPSRedirectHandler(backend.ListenAddr(serverCfg)))
+		redirect.Addr = net.JoinHostPort(serverCfg.Host, strconv.Itoa(serverCfg.TLS.RedirectHTTPPort))
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS", redirect.Addr)
+			if err := redirect.ListenAndServe(); err != nil {
+				log.Fatalf("HTTP redirect server error: %v", err)
+			}
+		}()
+	}
+
+	log.Printf("Starting HTTPS server on %s", ln.Addr())
+	if err := srv.ServeTLS(ln, "", ""); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }